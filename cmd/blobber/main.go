@@ -0,0 +1,106 @@
+// blobber is the reference blobber. It polls its queue from the controller,
+// downloads blobs with an external program (yt-dlp by default) and stores them
+// in a local directory or an S3 compatible object storage.
+//
+// Configuration (environment):
+//
+//	CONTROLLER_URL   base URL of the controller (default http://localhost:3000)
+//	BLOBBER_ID       id of the blobber
+//	BLOBBER_SECRET   secret of the blobber
+//	POLL_INTERVAL    delay between two pulls (default 30s)
+//	SOCKET           "off" disables pushed jobs and only polls the queue
+//	DOWNLOADER       path of the downloader program (default yt-dlp)
+//	WORK_DIR         directory for temporary downloads (default: system temp directory)
+//	STORE_DIR        directory to store blobs in (default ./blobs)
+//	S3_ENDPOINT      stores blobs in S3 instead of STORE_DIR, e.g. https://s3.eu-central-1.amazonaws.com
+//	S3_REGION, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY
+//	LISTEN_ADDR      serves the blobs of STORE_DIR on this address, e.g. :8080.
+//	                 The public URL of the blobber is configured on the controller.
+package main
+
+import (
+	"context"
+	"github.com/ICBX/penguin/internal/blobber"
+	"github.com/ICBX/penguin/pkg/client"
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/cli"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// version is reported with every heartbeat, it's set with -ldflags "-X main.version=..."
+var version = "dev"
+
+func init() {
+	log.SetHandler(cli.Default)
+	log.SetLevel(log.DebugLevel)
+}
+
+func env(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func main() {
+	id, err := strconv.ParseUint(os.Getenv("BLOBBER_ID"), 10, 32)
+	if err != nil {
+		log.WithError(err).Fatal("BLOBBER_ID is required")
+		return
+	}
+	secret := os.Getenv("BLOBBER_SECRET")
+	if secret == "" {
+		log.Fatal("BLOBBER_SECRET is required")
+		return
+	}
+	interval, err := time.ParseDuration(env("POLL_INTERVAL", blobber.DefaultPollInterval.String()))
+	if err != nil {
+		log.WithError(err).Fatal("invalid POLL_INTERVAL")
+		return
+	}
+
+	// store
+	var store blobber.Store
+	if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+		store = blobber.NewS3Store(endpoint, os.Getenv("S3_REGION"), os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+	} else if store, err = blobber.NewLocalStore(env("STORE_DIR", "blobs")); err != nil {
+		log.WithError(err).Fatal("cannot create store directory")
+		return
+	}
+
+	c := client.New(env("CONTROLLER_URL", "http://localhost:3000"), client.WithBlobber(uint(id), secret))
+	b := blobber.New(c, blobber.NewCommandDownloader(env("DOWNLOADER", "yt-dlp")), store)
+	b.PollInterval = interval
+	b.UseSocket = os.Getenv("SOCKET") != "off"
+	b.WorkDir = env("WORK_DIR", os.TempDir())
+	b.Version = version
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if addr := os.Getenv("LISTEN_ADDR"); addr != "" {
+		local, ok := store.(*blobber.LocalStore)
+		if !ok {
+			log.Fatal("LISTEN_ADDR is only supported for STORE_DIR")
+			return
+		}
+		srv := &http.Server{Addr: addr, Handler: blobber.NewBlobServer(local, secret)}
+		go func() {
+			log.Infof("[blobber] Serving blobs on %s", addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Fatal("cannot serve blobs")
+			}
+		}()
+		defer srv.Close()
+	}
+
+	log.Infof("[blobber] Polling queue of blobber %d every %s", id, interval)
+	b.Run(ctx)
+	log.Info("[blobber] Shut down.")
+}
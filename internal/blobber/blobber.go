@@ -0,0 +1,375 @@
+// Package blobber is the reference implementation of a blobber.
+// A blobber polls its queue from the controller, downloads blobs, stores them and reports them back.
+package blobber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ICBX/penguin/pkg/client"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPollInterval     = 30 * time.Second
+	DefaultProgressInterval = 10 * time.Second
+)
+
+// socketQueueSize is the maximum number of pushed jobs waiting for the worker
+const socketQueueSize = 256
+
+var (
+	ErrInvalidKey = errors.New("invalid video id for a storage key")
+	// ErrBlobNotFound is returned by stores if no blob is stored below a prefix
+	ErrBlobNotFound = errors.New("blob not found")
+)
+
+// Blobber processes the queue of a single blobber
+type Blobber struct {
+	client     *client.Client
+	downloader Downloader
+	store      Store
+
+	// PollInterval is the delay between two pulls and heartbeats
+	PollInterval time.Duration
+	// ProgressInterval is the delay between two progress reports of a download
+	ProgressInterval time.Duration
+	// UseSocket enables pushed jobs, the queue is polled while the socket is unavailable
+	UseSocket bool
+	// WorkDir contains the temporary download directories
+	WorkDir string
+	// Version is reported with every heartbeat
+	Version string
+
+	// serverInterval is the poll interval requested by the controller
+	serverInterval time.Duration
+}
+
+func New(c *client.Client, downloader Downloader, store Store) *Blobber {
+	return &Blobber{
+		client:           c,
+		downloader:       downloader,
+		store:            store,
+		PollInterval:     DefaultPollInterval,
+		ProgressInterval: DefaultProgressInterval,
+		UseSocket:        true,
+		WorkDir:          os.TempDir(),
+	}
+}
+
+// Run processes the queue until ctx is done
+func (b *Blobber) Run(ctx context.Context) {
+	for {
+		b.heartbeat(ctx)
+		if b.UseSocket {
+			if err := b.RunSocket(ctx); err != nil && ctx.Err() == nil {
+				log.WithError(err).Warn("[blobber] socket unavailable, polling queue")
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		n, err := b.Poll(ctx)
+		if err != nil {
+			log.WithError(err).Warn("[blobber] cannot process queue")
+		} else if n > 0 {
+			log.Infof("[blobber] processed %d jobs", n)
+		}
+
+		timer := time.NewTimer(b.pollDelay(err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *Blobber) heartbeat(ctx context.Context) {
+	hb := &client.Heartbeat{Version: b.Version}
+	if cs, ok := b.store.(CapacityStore); ok {
+		var err error
+		if hb.TotalBytes, hb.FreeBytes, err = cs.Capacity(); err != nil {
+			log.WithError(err).Warn("[blobber] cannot determine capacity")
+		}
+	}
+	res, err := b.client.Heartbeat(ctx, hb)
+	if err != nil {
+		log.WithError(err).Warn("[blobber] cannot send heartbeat")
+		return
+	}
+	for _, w := range res.Warnings {
+		log.Warnf("[blobber] %s", w)
+	}
+}
+
+// RunSocket processes jobs pushed over the socket until the connection is closed or ctx is done
+func (b *Blobber) RunSocket(ctx context.Context) (err error) {
+	var sock *client.Socket
+	if sock, err = b.client.Connect(ctx); err != nil {
+		return
+	}
+	log.Info("[blobber] connected to socket")
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(b.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// unblocks Read
+				_ = sock.Close()
+				return
+			case <-done:
+				_ = sock.Close()
+				return
+			case <-ticker.C:
+				b.heartbeat(ctx)
+			}
+		}
+	}()
+
+	// jobs are processed by a single worker, so the socket is read while a blob downloads
+	var (
+		mu      sync.Mutex
+		pending = make(map[client.Job]bool)
+		work    = make(chan client.Job, socketQueueSize)
+		wg      sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for job := range work {
+			if ctx.Err() == nil {
+				if err := b.process(ctx, job); err != nil {
+					log.WithError(err).Warnf("[blobber] cannot %s %s blob of %s", job.Action, job.Type, job.VideoID)
+				}
+			}
+			mu.Lock()
+			delete(pending, job)
+			mu.Unlock()
+		}
+	}()
+	defer func() {
+		close(work)
+		wg.Wait()
+	}()
+
+	for {
+		var msg *client.SocketMessage
+		if msg, err = sock.Read(); err != nil {
+			return
+		}
+		switch msg.Type {
+		case client.SocketJobs:
+			// jobs which don't fit into the queue aren't acknowledged and pushed again later
+			var accepted []client.Job
+			mu.Lock()
+			for _, job := range msg.Jobs {
+				if pending[job] || len(work) == cap(work) {
+					continue
+				}
+				pending[job] = true
+				work <- job
+				accepted = append(accepted, job)
+			}
+			mu.Unlock()
+			if len(accepted) > 0 {
+				if _, err = sock.Ack(accepted); err != nil {
+					return
+				}
+			}
+		case client.SocketResult:
+			if msg.Error != nil {
+				log.WithError(msg.Error).Warnf("[blobber] message %s failed", msg.ID)
+			}
+		}
+	}
+}
+
+// Poll pulls the queue once and processes all jobs.
+// Failed jobs are logged and stay queued, so they are retried with the next poll.
+// n is the number of successful jobs.
+func (b *Blobber) Poll(ctx context.Context) (n int, err error) {
+	var pull *client.PullResponse
+	if pull, err = b.client.Pull(ctx); err != nil {
+		return
+	}
+	b.serverInterval = time.Duration(pull.PollInterval) * time.Second
+	for _, job := range pull.Jobs {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		if err := b.process(ctx, job); err != nil {
+			log.WithError(err).Warnf("[blobber] cannot %s %s blob of %s", job.Action, job.Type, job.VideoID)
+			continue
+		}
+		n++
+	}
+	return
+}
+
+// pollDelay returns the delay until the next poll, which respects the interval requested by the controller
+func (b *Blobber) pollDelay(err error) time.Duration {
+	delay := b.PollInterval
+	if b.serverInterval > delay {
+		delay = b.serverInterval
+	}
+	var cerr *client.Error
+	if errors.As(err, &cerr) && cerr.RetryAfter > delay {
+		delay = cerr.RetryAfter
+	}
+	return delay
+}
+
+func (b *Blobber) process(ctx context.Context, job client.Job) (err error) {
+	if job.Type == 0 {
+		job.Type = common.VideoBlobType
+	}
+	var prefix string
+	if prefix, err = blobPrefix(job.VideoID, job.Type); err != nil {
+		return
+	}
+
+	report := &client.Report{
+		VideoID: job.VideoID,
+		Action:  job.Action,
+		Type:    job.Type,
+	}
+	switch job.Action {
+	case common.GetBlob:
+		if report.Path, report.Checksum, report.Size, err = b.download(ctx, job, prefix); err != nil {
+			return
+		}
+	case common.RemoveBlob:
+		if err = b.store.Delete(ctx, prefix); err != nil {
+			return
+		}
+	case common.VerifyBlob:
+		b.progress(ctx, job, "verifying", 0, 0)
+		report.Checksum, err = b.store.Checksum(ctx, prefix)
+		if errors.Is(err, ErrBlobNotFound) {
+			report.Missing, err = true, nil
+		}
+		if err != nil {
+			return
+		}
+	default:
+		return fmt.Errorf("unknown action %d", job.Action)
+	}
+	return b.client.Report(ctx, report)
+}
+
+// download downloads the blob into a temporary directory and stores all downloaded files below prefix.
+// loc is the location of the file, or of prefix if the downloader created multiple files (e.g. caption tracks).
+// sum is the checksum and size the total size of the downloaded files.
+func (b *Blobber) download(ctx context.Context, job client.Job, prefix string) (loc, sum string, size int64, err error) {
+	var dir string
+	if dir, err = os.MkdirTemp(b.WorkDir, "blobber-"); err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// report the size of the download directory until the download finished
+	done := make(chan struct{})
+	go b.watchDownload(ctx, job, dir, done)
+
+	var files []string
+	files, err = b.downloader.Download(ctx, job.VideoID, job.Type, dir)
+	close(done)
+	if err != nil {
+		return
+	}
+	if len(files) == 0 {
+		return "", "", 0, errors.New("downloader created no files")
+	}
+
+	sums := make(map[string]string, len(files))
+	for _, f := range files {
+		if sums[filepath.Base(f)], err = fileChecksum(f); err != nil {
+			return
+		}
+	}
+	sum = checksum(sums)
+
+	size = dirSize(dir)
+	b.progress(ctx, job, "storing", size, size)
+
+	// remove blobs of a previous download
+	if err = b.store.Delete(ctx, prefix); err != nil {
+		return
+	}
+	for _, f := range files {
+		if loc, err = b.store.Put(ctx, prefix+filepath.Base(f), f); err != nil {
+			return
+		}
+	}
+	if len(files) > 1 {
+		loc = b.store.Location(prefix)
+	}
+	return
+}
+
+// watchDownload reports the progress of the download in dir until done is closed
+func (b *Blobber) watchDownload(ctx context.Context, job client.Job, dir string, done <-chan struct{}) {
+	b.progress(ctx, job, "downloading", 0, 0)
+
+	ticker := time.NewTicker(b.ProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.progress(ctx, job, "downloading", dirSize(dir), 0)
+		}
+	}
+}
+
+// progress reports the progress of a job, failed reports are only logged
+func (b *Blobber) progress(ctx context.Context, job client.Job, stage string, done, total int64) {
+	if err := b.client.Progress(ctx, &client.Progress{
+		VideoID:    job.VideoID,
+		Action:     job.Action,
+		Type:       job.Type,
+		Stage:      stage,
+		BytesDone:  done,
+		BytesTotal: total,
+	}); err != nil {
+		log.WithError(err).Debugf("[blobber] cannot report progress of %s", job.VideoID)
+	}
+}
+
+// dirSize returns the size of all files in dir
+func dirSize(dir string) (size int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+	return
+}
+
+// blobPrefix returns the storage key prefix of all files of a blob: <video id>/<type>/
+func blobPrefix(videoID string, typ common.BlobType) (string, error) {
+	if videoID == "" || videoID == "." || videoID == ".." || strings.ContainsAny(videoID, `/\`) {
+		return "", ErrInvalidKey
+	}
+	return videoID + "/" + typ.String() + "/", nil
+}
@@ -0,0 +1,90 @@
+package blobber
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ICBX/penguin/pkg/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Downloader downloads a blob of a video into dir and returns the paths of the created files
+type Downloader interface {
+	Download(ctx context.Context, videoID string, typ common.BlobType, dir string) (files []string, err error)
+}
+
+// placeholders in the arguments of a CommandDownloader
+const (
+	// PlaceholderURL is replaced by the watch URL of the video
+	PlaceholderURL = "{url}"
+	// PlaceholderID is replaced by the video id
+	PlaceholderID = "{id}"
+	// PlaceholderDir is replaced by the download directory
+	PlaceholderDir = "{dir}"
+)
+
+// YTDLPArgs are the default arguments of the CommandDownloader for yt-dlp
+var YTDLPArgs = map[common.BlobType][]string{
+	common.VideoBlobType: {"--quiet", "--no-progress",
+		"--output", "{dir}/{id}.%(ext)s", "{url}"},
+	common.ThumbnailBlobType: {"--quiet", "--no-progress", "--skip-download", "--write-thumbnail",
+		"--output", "{dir}/{id}.%(ext)s", "{url}"},
+	common.CaptionBlobType: {"--quiet", "--no-progress", "--skip-download", "--write-subs", "--sub-langs", "all",
+		"--output", "{dir}/{id}.%(ext)s", "{url}"},
+}
+
+// CommandDownloader runs an external program like yt-dlp for every download.
+// All files the program creates in the download directory are stored.
+type CommandDownloader struct {
+	// Path of the program
+	Path string
+	// Args are the arguments of the program by blob type, placeholders are replaced
+	Args map[common.BlobType][]string
+}
+
+// NewCommandDownloader returns a downloader for the program at path using the yt-dlp arguments
+func NewCommandDownloader(path string) *CommandDownloader {
+	return &CommandDownloader{
+		Path: path,
+		Args: YTDLPArgs,
+	}
+}
+
+func (d *CommandDownloader) Download(ctx context.Context, videoID string, typ common.BlobType, dir string) (files []string, err error) {
+	args, ok := d.Args[typ]
+	if !ok {
+		return nil, fmt.Errorf("%s blobs are not supported by the downloader", typ)
+	}
+
+	r := strings.NewReplacer(
+		PlaceholderURL, "https://www.youtube.com/watch?v="+videoID,
+		PlaceholderID, videoID,
+		PlaceholderDir, dir)
+	replaced := make([]string, len(args))
+	for i, a := range args {
+		replaced[i] = r.Replace(a)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, d.Path, replaced...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(d.Path), err, strings.TrimSpace(stderr.String()))
+	}
+
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(dir); err != nil {
+		return
+	}
+	for _, e := range entries {
+		// skip partial downloads
+		if e.Type().IsRegular() && !strings.HasSuffix(e.Name(), ".part") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return
+}
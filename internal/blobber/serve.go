@@ -0,0 +1,103 @@
+package blobber
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BlobServer serves the blobs of a LocalStore at /blob/<video id>/<type> to clients
+// with a URL signed by the controller. Blobs with multiple files (e.g. caption tracks)
+// list their files, a single file is selected with ?file=<name>.
+type BlobServer struct {
+	store  *LocalStore
+	secret string
+}
+
+func NewBlobServer(store *LocalStore, secret string) *BlobServer {
+	return &BlobServer{store: store, secret: secret}
+}
+
+func (s *BlobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/blob/"), "/")
+	if !strings.HasPrefix(r.URL.Path, "/blob/") || len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	videoID, typeName := parts[0], parts[1]
+
+	var typ common.BlobType
+	for _, t := range []common.BlobType{common.VideoBlobType, common.ThumbnailBlobType, common.CaptionBlobType} {
+		if t.String() == typeName {
+			typ = t
+		}
+	}
+	prefix, err := blobPrefix(videoID, typ)
+	if typ == 0 || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the signature covers the path which is sent by the controller
+	if err = common.VerifyBlobQuery(s.secret, common.BlobPath(videoID, typ), r.URL.Query(), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	dir := s.store.Location(prefix)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files)
+
+	name := r.URL.Query().Get("file")
+	if name == "" && len(files) == 1 {
+		name = files[0]
+	}
+	if name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(files)
+		return
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "cannot open blob", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, "cannot open blob", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+}
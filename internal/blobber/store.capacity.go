@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package blobber
+
+import "syscall"
+
+// Capacity returns the size and the space available to unprivileged users of the file system of the store
+func (s *LocalStore) Capacity() (total, free int64, err error) {
+	var st syscall.Statfs_t
+	if err = syscall.Statfs(s.Root, &st); err != nil {
+		return
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
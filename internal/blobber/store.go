@@ -0,0 +1,141 @@
+package blobber
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Store persists downloaded blobs by their key (<video id>/<type>/<file name>)
+type Store interface {
+	// Put stores the file and returns its location which is reported to the controller
+	Put(ctx context.Context, key, file string) (loc string, err error)
+	// Delete removes all blobs whose key starts with prefix
+	Delete(ctx context.Context, prefix string) error
+	// Location returns the location of a key or prefix
+	Location(key string) string
+	// Checksum re-hashes all blobs whose key starts with prefix,
+	// ErrBlobNotFound is returned if there are none
+	Checksum(ctx context.Context, prefix string) (sum string, err error)
+}
+
+// CapacityStore is implemented by stores which know the capacity of their storage
+type CapacityStore interface {
+	Capacity() (total, free int64, err error)
+}
+
+// checksum combines the SHA-256 hashes of the files of a blob by their name.
+// The checksum of a blob with a single file is the hash of the file.
+func checksum(sums map[string]string) string {
+	names := make([]string, 0, len(sums))
+	for n := range sums {
+		names = append(names, n)
+	}
+	if len(names) == 1 {
+		return sums[names[0]]
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, n := range names {
+		_, _ = io.WriteString(h, n+" "+sums[n]+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func fileChecksum(file string) (sum string, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LocalStore stores blobs in a directory
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) (s *LocalStore, err error) {
+	if root, err = filepath.Abs(root); err != nil {
+		return
+	}
+	if err = os.MkdirAll(root, 0o755); err != nil {
+		return
+	}
+	return &LocalStore{Root: root}, nil
+}
+
+func (s *LocalStore) Location(key string) string {
+	loc := filepath.Join(s.Root, filepath.FromSlash(key))
+	if strings.HasSuffix(key, "/") {
+		loc += string(filepath.Separator)
+	}
+	return loc
+}
+
+func (s *LocalStore) Put(_ context.Context, key, file string) (loc string, err error) {
+	loc = s.Location(key)
+	if err = os.MkdirAll(filepath.Dir(loc), 0o755); err != nil {
+		return
+	}
+
+	// rename is cheap if the work directory is on the same file system
+	if err = os.Rename(file, loc); err == nil {
+		return
+	}
+
+	var src, dst *os.File
+	if src, err = os.Open(file); err != nil {
+		return
+	}
+	defer src.Close()
+	if dst, err = os.Create(loc); err != nil {
+		return
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return
+	}
+	err = dst.Close()
+	return
+}
+
+func (s *LocalStore) Delete(_ context.Context, prefix string) error {
+	return os.RemoveAll(s.Location(prefix))
+}
+
+func (s *LocalStore) Checksum(ctx context.Context, prefix string) (sum string, err error) {
+	dir := s.Location(prefix)
+	sums := make(map[string]string)
+	if err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)], err = fileChecksum(path)
+		return err
+	}); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if len(sums) == 0 {
+		return "", ErrBlobNotFound
+	}
+	return checksum(sums), nil
+}
@@ -0,0 +1,284 @@
+package blobber
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Store stores blobs in a bucket of an S3 compatible object storage (AWS, MinIO, ...).
+// Requests use path-style URLs and are signed with AWS Signature Version 4.
+type S3Store struct {
+	// Endpoint is the base URL of the storage, e.g. https://s3.eu-central-1.amazonaws.com
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	client *http.Client
+}
+
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string) *S3Store {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Store{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Region:    region,
+		Bucket:    bucket,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		client:    &http.Client{Timeout: 30 * time.Minute},
+	}
+}
+
+func (s *S3Store) Location(key string) string {
+	return "s3://" + s.Bucket + "/" + key
+}
+
+func (s *S3Store) Put(ctx context.Context, key, file string) (loc string, err error) {
+	var f *os.File
+	if f, err = os.Open(file); err != nil {
+		return
+	}
+	defer f.Close()
+
+	var stat os.FileInfo
+	if stat, err = f.Stat(); err != nil {
+		return
+	}
+
+	// the payload is hashed before it's uploaded because not every storage accepts unsigned payloads
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key, nil), f); err != nil {
+		return
+	}
+	req.ContentLength = stat.Size()
+	if err = s.do(req, hex.EncodeToString(h.Sum(nil)), nil); err != nil {
+		return
+	}
+	return s.Location(key), nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Store) Delete(ctx context.Context, prefix string) (err error) {
+	return s.list(ctx, prefix, func(key string) (err error) {
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key, nil), nil); err != nil {
+			return
+		}
+		return s.do(req, emptyHash, nil)
+	})
+}
+
+// Checksum downloads all objects below prefix to hash them
+func (s *S3Store) Checksum(ctx context.Context, prefix string) (sum string, err error) {
+	sums := make(map[string]string)
+	if err = s.list(ctx, prefix, func(key string) (err error) {
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key, nil), nil); err != nil {
+			return
+		}
+		h := sha256.New()
+		if err = s.do(req, emptyHash, h); err != nil {
+			return
+		}
+		sums[strings.TrimPrefix(key, prefix)] = hex.EncodeToString(h.Sum(nil))
+		return
+	}); err != nil {
+		return
+	}
+	if len(sums) == 0 {
+		return "", ErrBlobNotFound
+	}
+	return checksum(sums), nil
+}
+
+// list calls fn for the key of every object below prefix
+func (s *S3Store) list(ctx context.Context, prefix string, fn func(key string) error) (err error) {
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL("", query), nil); err != nil {
+			return
+		}
+		var list listBucketResult
+		if err = s.do(req, emptyHash, &list); err != nil {
+			return
+		}
+
+		for _, obj := range list.Contents {
+			if err = fn(obj.Key); err != nil {
+				return
+			}
+		}
+
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+func (s *S3Store) objectURL(key string, query url.Values) string {
+	u := s.Endpoint + "/" + s.Bucket
+	if key != "" {
+		u += "/" + escapePath(key)
+	}
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do signs and sends the request and decodes an XML response into out,
+// the response is copied if out is an io.Writer
+func (s *S3Store) do(req *http.Request, payloadHash string, out interface{}) (err error) {
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	var resp *http.Response
+	if resp, err = s.client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("s3 %s %s returned %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return
+	}
+	if w, ok := out.(io.Writer); ok {
+		_, err = io.Copy(w, resp.Body)
+		return
+	}
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
+
+//// AWS Signature Version 4
+
+// emptyHash is the SHA-256 hash of an empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// escapePath escapes every path segment as required by S3
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape escapes everything except the unreserved characters of RFC 3986
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,277 @@
+package events
+
+import (
+	"github.com/ICBX/penguin/internal/metrics"
+	"github.com/apex/log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Type string
+
+//goland:noinspection ALL
+const (
+	VideoTitleChanged Type = "video.title_changed"
+	VideoPrivate      Type = "video.private"
+	VideoDeleted      Type = "video.deleted"
+	VideoArchived     Type = "video.archived"
+	VideoChanged      Type = "video.changed"
+
+	VideoAvailabilityChanged Type = "video.availability_changed"
+
+	QueueEnqueued  Type = "queue.enqueued"
+	QueueCompleted Type = "queue.completed"
+	QueueProgress  Type = "queue.progress"
+	QueueReleased  Type = "queue.released"
+
+	BlobVerified Type = "blob.verified"
+	BlobDamaged  Type = "blob.damaged"
+
+	UpdaterStarted  Type = "updater.started"
+	UpdaterFinished Type = "updater.finished"
+
+	// StreamReset isn't published, it tells resuming stream clients that they missed events
+	StreamReset Type = "stream.reset"
+)
+
+// Types contains all published event types
+var Types = []Type{
+	VideoTitleChanged, VideoPrivate, VideoDeleted, VideoArchived, VideoChanged, VideoAvailabilityChanged,
+	QueueEnqueued, QueueCompleted, QueueProgress, QueueReleased,
+	BlobVerified, BlobDamaged,
+	UpdaterStarted, UpdaterFinished,
+}
+
+// VideoAlerts are the events which need the attention of an administrator,
+// webhooks without a list of event types receive them
+var VideoAlerts = []Type{VideoTitleChanged, VideoPrivate, VideoDeleted, VideoArchived}
+
+// IsAlert checks if typ is one of VideoAlerts
+func IsAlert(typ Type) bool {
+	for _, t := range VideoAlerts {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Known checks if typ is one of Types
+func Known(typ Type) bool {
+	for _, t := range Types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultHistorySize is the number of events kept by a bus for resuming subscribers
+const DefaultHistorySize = 1024
+
+// Event is emitted by the controller whenever something noteworthy happens
+type Event struct {
+	ID      uint64      `json:"id"`
+	Type    Type        `json:"type"`
+	Time    time.Time   `json:"time"`
+	VideoID string      `json:"videoID,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Change is the payload of events caused by a changed field
+type Change struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// VideoChange is the payload of VideoChanged events
+type VideoChange struct {
+	Fields []string `json:"fields"`
+}
+
+// QueueJob is the payload of queue events
+type QueueJob struct {
+	BlobberID uint   `json:"blobberID"`
+	Action    string `json:"action"`
+	Type      string `json:"type,omitempty"`
+}
+
+// QueueJobProgress is the payload of progress events
+type QueueJobProgress struct {
+	QueueJob
+	Stage      string `json:"stage,omitempty"`
+	BytesDone  int64  `json:"bytesDone"`
+	BytesTotal int64  `json:"bytesTotal,omitempty"`
+	ETA        int64  `json:"eta,omitempty"`
+}
+
+// BlobVerification is the payload of blob events
+type BlobVerification struct {
+	BlobberID uint   `json:"blobberID"`
+	Type      string `json:"type"`
+	// Status is "ok", "missing" or "corrupt"
+	Status string `json:"status"`
+}
+
+// UpdaterRun is the payload of updater events
+type UpdaterRun struct {
+	Videos    int    `json:"videos"`
+	Downloads int    `json:"downloads,omitempty"`
+	Duration  string `json:"duration,omitempty"`
+}
+
+// Bus distributes published events to all subscribers
+// and keeps the latest events in a bounded ring buffer
+type Bus struct {
+	mu     sync.Mutex
+	lastID uint64
+	// epoch identifies the bus, ids restart at 1 with every bus (e.g. after a restart)
+	epoch string
+	// subs maps the channel of every subscription to its event types, nil for all types
+	subs map[chan Event]map[Type]bool
+
+	// history is a ring buffer, head points to the oldest event once the buffer is full
+	history []Event
+	head    int
+	size    int
+}
+
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		subs:    make(map[chan Event]map[Type]bool),
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		history: make([]Event, historySize),
+	}
+}
+
+// Publish assigns an ID to the event and sends it to all subscribers.
+// Subscribers which can't keep up miss the event instead of blocking the publisher,
+// missed events are counted and missed video alerts are logged.
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	// append to history
+	if len(b.history) > 0 {
+		if b.size < len(b.history) {
+			b.history[(b.head+b.size)%len(b.history)] = e
+			b.size++
+		} else {
+			b.history[b.head] = e
+			b.head = (b.head + 1) % len(b.history)
+		}
+	}
+
+	for ch, types := range b.subs {
+		if types != nil && !types[e.Type] {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			metrics.EventsDropped.WithLabelValues(string(e.Type)).Inc()
+			if IsAlert(e.Type) {
+				log.Warnf("[Events] a subscriber missed event %d (%s) of video %s", e.ID, e.Type, e.VideoID)
+			}
+		}
+	}
+	return e
+}
+
+// Subscribe returns a channel receiving all events published after the call
+// and a function to cancel the subscription
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	_, _, ch, cancel := b.SubscribeSince(b.LastID(), buffer)
+	return ch, cancel
+}
+
+// SubscribeTypes works like Subscribe but only receives events of the given types,
+// so frequent events of other types can't fill the buffer
+func (b *Bus) SubscribeTypes(buffer int, types ...Type) (<-chan Event, func()) {
+	filter := make(map[Type]bool, len(types))
+	for _, t := range types {
+		filter[t] = true
+	}
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = filter
+	b.mu.Unlock()
+	return ch, b.cancelFunc(ch)
+}
+
+// SubscribeSince works like Subscribe but additionally returns all buffered events with an ID greater than lastID.
+// missed is set if events after lastID were already dropped from the history (or lastID is from another bus),
+// those events are missing from replay.
+func (b *Bus) SubscribeSince(lastID uint64, buffer int) (replay []Event, missed bool, events <-chan Event, cancel func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	// the history contains the events from oldest to lastID without gaps
+	oldest := b.lastID - uint64(b.size) + 1
+	missed = lastID > b.lastID || lastID+1 < oldest
+	for i := 0; i < b.size; i++ {
+		if e := b.history[(b.head+i)%len(b.history)]; e.ID > lastID {
+			replay = append(replay, e)
+		}
+	}
+	b.subs[ch] = nil
+	b.mu.Unlock()
+
+	return replay, missed, ch, b.cancelFunc(ch)
+}
+
+// cancelFunc returns a function which ends the subscription of ch and closes it once
+func (b *Bus) cancelFunc(ch chan Event) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// LastID returns the ID of the last published event
+func (b *Bus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// Epoch returns the identifier of the bus which distinguishes its ids from the ids of other buses
+func (b *Bus) Epoch() string {
+	return b.epoch
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Default is the bus used by the package level functions
+var Default = NewBus(DefaultHistorySize)
+
+// Publish publishes an event on the default bus
+func Publish(typ Type, videoID string, data interface{}) Event {
+	return Default.Publish(Event{
+		Type:    typ,
+		VideoID: videoID,
+		Data:    data,
+	})
+}
+
+// Subscribe subscribes to the default bus
+func Subscribe(buffer int) (<-chan Event, func()) {
+	return Default.Subscribe(buffer)
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"github.com/ICBX/penguin/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBusReplay(t *testing.T) {
+	b := NewBus(3)
+	for i := 0; i < 5; i++ {
+		b.Publish(Event{Type: VideoChanged})
+	}
+	assert.Equal(t, uint64(5), b.LastID())
+
+	// only the last three events are kept
+	replay, missed, _, cancel := b.SubscribeSince(0, 1)
+	defer cancel()
+	assert.True(t, missed)
+	if assert.Len(t, replay, 3) {
+		assert.Equal(t, uint64(3), replay[0].ID)
+		assert.Equal(t, uint64(5), replay[2].ID)
+	}
+
+	replay, missed, _, cancel2 := b.SubscribeSince(4, 1)
+	defer cancel2()
+	assert.False(t, missed)
+	if assert.Len(t, replay, 1) {
+		assert.Equal(t, uint64(5), replay[0].ID)
+	}
+
+	// the oldest kept event directly follows lastID
+	replay, missed, _, cancel3 := b.SubscribeSince(2, 1)
+	defer cancel3()
+	assert.False(t, missed)
+	assert.Len(t, replay, 3)
+
+	// ids of a previous bus (e.g. before a restart)
+	replay, missed, _, cancel4 := b.SubscribeSince(10, 1)
+	defer cancel4()
+	assert.True(t, missed)
+	assert.Len(t, replay, 0)
+}
+
+func TestBusSubscribe(t *testing.T) {
+	b := NewBus(0)
+	ch, cancel := b.Subscribe(1)
+
+	b.Publish(Event{Type: QueueEnqueued, VideoID: "hello"})
+	e := <-ch
+	assert.Equal(t, uint64(1), e.ID)
+	assert.Equal(t, "hello", e.VideoID)
+	assert.False(t, e.Time.IsZero())
+
+	// slow subscribers don't block the publisher
+	b.Publish(Event{Type: QueueEnqueued})
+	b.Publish(Event{Type: QueueEnqueued})
+
+	cancel()
+	_, more := <-ch
+	assert.True(t, more)
+	_, more = <-ch
+	assert.False(t, more)
+}
+
+func TestBusSubscribeTypes(t *testing.T) {
+	b := NewBus(0)
+	ch, cancel := b.SubscribeTypes(1, VideoPrivate)
+	defer cancel()
+
+	// other events don't fill the buffer
+	for i := 0; i < 10; i++ {
+		b.Publish(Event{Type: QueueProgress})
+	}
+	b.Publish(Event{Type: VideoPrivate, VideoID: "hello"})
+	e := <-ch
+	assert.Equal(t, uint64(11), e.ID)
+
+	// missed events are counted
+	dropped := testutil.ToFloat64(metrics.EventsDropped.WithLabelValues(string(VideoPrivate)))
+	b.Publish(Event{Type: VideoPrivate})
+	b.Publish(Event{Type: VideoPrivate})
+	assert.Equal(t, dropped+1, testutil.ToFloat64(metrics.EventsDropped.WithLabelValues(string(VideoPrivate))))
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "depth"),
+		"Number of queued jobs by blobber and action",
+		[]string{"blobber", "action"}, nil,
+	)
+	videosDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "videos", "count"),
+		"Number of tracked videos by privacy status",
+		[]string{"privacy"}, nil,
+	)
+)
+
+// DBCollector collects gauges which are read from the database on every scrape
+type DBCollector struct {
+	db *gorm.DB
+}
+
+func NewDBCollector(db *gorm.DB) *DBCollector {
+	return &DBCollector{db: db}
+}
+
+func (c *DBCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- videosDesc
+}
+
+func (c *DBCollector) Collect(ch chan<- prometheus.Metric) {
+	// queue depth per blobber and action
+	var queue []struct {
+		BlobberID uint
+		Action    common.QueueAction
+		Count     int64
+	}
+	if err := c.db.Model(&common.Queue{}).
+		Select("blobber_id, action, COUNT(*) AS count").
+		Group("blobber_id, action").
+		Scan(&queue).Error; err != nil {
+		log.WithError(err).Warn("[Metrics] cannot collect queue depth")
+	}
+	for _, q := range queue {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(q.Count),
+			strconv.FormatUint(uint64(q.BlobberID), 10), q.Action.String())
+	}
+
+	// videos by privacy status
+	var videos []struct {
+		PrivacyStatus common.PrivacyStatus
+		Count         int64
+	}
+	if err := c.db.Model(&common.Video{}).
+		Select("privacy_status, COUNT(*) AS count").
+		Group("privacy_status").
+		Scan(&videos).Error; err != nil {
+		log.WithError(err).Warn("[Metrics] cannot collect video count")
+	}
+	for _, v := range videos {
+		ch <- prometheus.MustNewConstMetric(videosDesc, prometheus.GaugeValue, float64(v.Count),
+			v.PrivacyStatus.String())
+	}
+}
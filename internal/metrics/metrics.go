@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+const namespace = "penguin"
+
+var (
+	// MetaUpdateDuration is observed after every run of the meta updater cronjob
+	MetaUpdateDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "meta_update",
+		Name:      "duration_seconds",
+		Help:      "Duration of a full meta update run",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+
+	// VideosRefreshed counts videos which were successfully refreshed by the meta updater
+	VideosRefreshed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "meta_update",
+		Name:      "videos_refreshed_total",
+		Help:      "Number of videos refreshed by the meta updater",
+	})
+
+	// APIErrors counts failed YouTube Data API calls by error reason
+	APIErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "youtube",
+		Name:      "api_errors_total",
+		Help:      "Number of failed YouTube Data API calls by reason",
+	}, []string{"reason"})
+
+	// BlobberPulls counts queue pulls by blobber
+	BlobberPulls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "blobber",
+		Name:      "pull_requests_total",
+		Help:      "Number of queue pull requests by blobber",
+	}, []string{"blobber"})
+
+	// EventsDropped counts events which a subscriber of the event bus missed because it couldn't keep up
+	EventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "events",
+		Name:      "dropped_total",
+		Help:      "Number of events missed by slow subscribers by event type",
+	}, []string{"type"})
+
+	// HTTPRequestDuration observes REST request latencies by route
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "REST request latencies by method, route and status code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// Collectors contains all static collectors of the controller
+var Collectors = []prometheus.Collector{
+	MetaUpdateDuration,
+	VideosRefreshed,
+	APIErrors,
+	BlobberPulls,
+	EventsDropped,
+	HTTPRequestDuration,
+}
+
+// NewRegistry returns a registry containing all static collectors,
+// the database collector and the default process and go collectors
+func NewRegistry(db *gorm.DB) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(Collectors...)
+	reg.MustRegister(
+		NewDBCollector(db),
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	return reg
+}
@@ -0,0 +1,165 @@
+// Package ratelimit contains in-memory limiters for the REST API
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneInterval is the minimum delay between two removals of idle keys
+const pruneInterval = time.Minute
+
+// Limiter is a token bucket per key. Every key may do Burst requests at once
+// and gets one more request every Interval.
+type Limiter struct {
+	Interval time.Duration
+	Burst    int
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(interval time.Duration, burst int) *Limiter {
+	return &Limiter{
+		Interval: interval,
+		Burst:    burst,
+		buckets:  make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token of the key. If there is none left, retryAfter is the delay until the next token.
+// Limiters without interval or burst allow every request.
+func (l *Limiter) Allow(key string, now time.Time) (ok bool, retryAfter time.Duration) {
+	if l == nil || l.Interval <= 0 || l.Burst <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.Interval))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	tokens := b.tokens + float64(now.Sub(b.last))/float64(l.Interval)
+	if max := float64(l.Burst); tokens > max {
+		tokens = max
+	}
+	return tokens
+}
+
+// prune removes keys whose bucket is full again, they behave like new keys
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Lockout locks keys after MaxFailures failures within Window for Duration
+type Lockout struct {
+	MaxFailures int
+	Window      time.Duration
+	Duration    time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]*failures
+	lastPrune time.Time
+}
+
+type failures struct {
+	count       int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+func NewLockout(maxFailures int, window, duration time.Duration) *Lockout {
+	return &Lockout{
+		MaxFailures: maxFailures,
+		Window:      window,
+		Duration:    duration,
+		keys:        make(map[string]*failures),
+	}
+}
+
+// Locked returns the remaining time of the lock of key, 0 if the key isn't locked
+func (l *Lockout) Locked(key string, now time.Time) time.Duration {
+	if l == nil || l.MaxFailures <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.keys[key]
+	if !ok || !now.Before(f.lockedUntil) {
+		return 0
+	}
+	return f.lockedUntil.Sub(now)
+}
+
+// Fail records a failure of key and returns true if the key is locked now
+func (l *Lockout) Fail(key string, now time.Time) (locked bool) {
+	if l == nil || l.MaxFailures <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	f, ok := l.keys[key]
+	if !ok || now.Sub(f.first) > l.Window {
+		f = &failures{first: now}
+		l.keys[key] = f
+	}
+	f.count++
+	if f.count >= l.MaxFailures {
+		f.lockedUntil = now.Add(l.Duration)
+		f.count, f.first = 0, now
+		return true
+	}
+	return false
+}
+
+// Reset forgets the failures of key, e.g. after a successful login
+func (l *Lockout) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
+
+// prune removes keys which are neither locked nor have failures within the window
+func (l *Lockout) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for key, f := range l.keys {
+		if !now.Before(f.lockedUntil) && now.Sub(f.first) > l.Window {
+			delete(l.keys, key)
+		}
+	}
+}
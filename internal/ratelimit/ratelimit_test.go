@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(time.Second, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow("a", now)
+		assert.True(t, ok)
+	}
+	ok, retry := l.Allow("a", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retry)
+
+	// keys are limited independently
+	ok, _ = l.Allow("b", now)
+	assert.True(t, ok)
+
+	ok, retry = l.Allow("a", now.Add(500*time.Millisecond))
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retry)
+	ok, _ = l.Allow("a", now.Add(time.Second))
+	assert.True(t, ok)
+
+	// idle keys are removed
+	l.Allow("c", now.Add(time.Hour))
+	assert.Len(t, l.buckets, 1)
+
+	// disabled limiters allow everything
+	var disabled *Limiter
+	ok, _ = disabled.Allow("a", now)
+	assert.True(t, ok)
+}
+
+func TestLockout(t *testing.T) {
+	l := NewLockout(3, time.Minute, 10*time.Minute)
+	now := time.Now()
+
+	assert.False(t, l.Fail("a", now))
+	assert.False(t, l.Fail("a", now))
+	assert.Zero(t, l.Locked("a", now))
+	assert.True(t, l.Fail("a", now))
+	assert.Equal(t, 10*time.Minute, l.Locked("a", now))
+	assert.Zero(t, l.Locked("b", now))
+	assert.Zero(t, l.Locked("a", now.Add(10*time.Minute)))
+
+	// failures outside of the window don't count
+	assert.False(t, l.Fail("b", now))
+	assert.False(t, l.Fail("b", now))
+	assert.False(t, l.Fail("b", now.Add(2*time.Minute)))
+
+	l.Reset("b")
+	assert.False(t, l.Fail("b", now))
+	assert.False(t, l.Fail("b", now))
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditReasonHeader contains the reason for an administrative request,
+// a JSON body may contain a "reason" field instead
+const AuditReasonHeader = "X-Audit-Reason"
+
+const auditLocal = "audit"
+
+// auditEntry describes the action of a handler for the audit log
+type auditEntry struct {
+	Action string
+	Target string
+	Before interface{}
+	After  interface{}
+}
+
+// auditSkipped contains the mutating routes which are used by blobbers instead of administrators
+var auditSkipped = map[string]bool{
+	RouteBlobberReport:    true,
+	RouteBlobberHeartbeat: true,
+	RouteBlobberProgress:  true,
+}
+
+// audit describes the action of the current request,
+// the entry is only written if the request succeeds
+func audit(ctx *fiber.Ctx, action, target string, before, after interface{}) {
+	ctx.Locals(auditLocal, &auditEntry{
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	})
+}
+
+// auditTarget formats the target of an audit log entry
+func auditTarget(resource string, id interface{}) string {
+	switch v := id.(type) {
+	case uint:
+		return resource + ":" + strconv.FormatUint(uint64(v), 10)
+	case string:
+		return resource + ":" + v
+	}
+	return resource
+}
+
+// auditMiddleware writes an audit log entry for every successful mutating request
+func (s *Server) auditMiddleware(ctx *fiber.Ctx) (err error) {
+	if err = ctx.Next(); err != nil {
+		return
+	}
+	switch ctx.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return
+	}
+	if ctx.Response().StatusCode() >= fiber.StatusBadRequest || auditSkipped[ctx.Route().Path] {
+		return
+	}
+
+	entry, ok := ctx.Locals(auditLocal).(*auditEntry)
+	if !ok {
+		// handlers which don't describe their action are logged by their route
+		entry = &auditEntry{
+			Action: ctx.Method() + " " + ctx.Route().Path,
+			Target: utils.CopyString(ctx.Path()),
+		}
+	}
+
+	l := &common.AuditLog{
+		Time:      time.Now(),
+		Actor:     s.auditActor(ctx),
+		IP:        ctx.IP(),
+		RequestID: ctx.GetRespHeader(fiber.HeaderXRequestID),
+		Action:    entry.Action,
+		Target:    entry.Target,
+		Before:    auditJSON(entry.Before),
+		After:     auditJSON(entry.After),
+		Reason:    auditReason(ctx),
+	}
+	// the request already succeeded, a missing entry must not turn it into an error
+	if err = s.db.Create(l).Error; err != nil {
+		log.WithError(err).Warnf("[%s] Cannot write audit log of %s %s", l.RequestID, l.Action, l.Target)
+		err = nil
+	}
+	return
+}
+
+// auditActor identifies the bearer token of the request without storing it
+func (s *Server) auditActor(ctx *fiber.Ctx) string {
+	token := strings.TrimSpace(strings.TrimPrefix(ctx.Get(fiber.HeaderAuthorization), "Bearer "))
+	if token == "" {
+		return "anonymous"
+	}
+	token = utils.CopyString(token)
+
+	var key common.APIKey
+	if err := s.db.Where(&common.APIKey{Key: token}).First(&key).Error; err == nil {
+		return "key:" + strconv.FormatUint(uint64(key.ID), 10)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+// auditReason returns the reason from the header or the JSON body of the request
+func auditReason(ctx *fiber.Ctx) string {
+	if reason := strings.TrimSpace(ctx.Get(AuditReasonHeader)); reason != "" {
+		return utils.CopyString(reason)
+	}
+	if !strings.HasPrefix(strings.ToLower(ctx.Get(fiber.HeaderContentType)), fiber.MIMEApplicationJSON) {
+		return ""
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	// bodies without a reason (or which aren't objects) are fine
+	_ = json.Unmarshal(ctx.Body(), &body)
+	return strings.TrimSpace(body.Reason)
+}
+
+// auditJSON encodes the state of an audit log entry, nil states are empty
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
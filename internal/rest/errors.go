@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// problemResponse is the body of every error response
+type problemResponse struct {
+	Code      int                  `json:"code"`
+	Message   string               `json:"message"`
+	Errors    []*common.FieldError `json:"errors,omitempty"`
+	RequestID string               `json:"requestID"`
+}
+
+// newProblem converts the error returned by a handler to a problem document
+func newProblem(err error) (p problemResponse) {
+	p = problemResponse{
+		Code:    fiber.StatusInternalServerError,
+		Message: err.Error(),
+	}
+
+	var (
+		ferr   *fiber.Error
+		verr   *common.ValidationError
+		syntax *json.SyntaxError
+		typ    *json.UnmarshalTypeError
+		rl     *RateLimitError
+	)
+	switch {
+	case errors.As(err, &rl):
+		p.Code = fiber.StatusTooManyRequests
+	case errors.As(err, &ferr):
+		p.Code = ferr.Code
+	case errors.As(err, &verr):
+		p.Code = fiber.StatusBadRequest
+		p.Errors = verr.Fields
+	case errors.Is(err, common.ErrNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		p.Code = fiber.StatusNotFound
+	case errors.Is(err, common.ErrConflict):
+		p.Code = fiber.StatusConflict
+	case errors.Is(err, common.ErrBlobberFull):
+		p.Code = fiber.StatusInsufficientStorage
+	case errors.Is(err, common.ErrInvalidVideoID):
+		p.Code = fiber.StatusBadRequest
+	case errors.As(err, &syntax):
+		p.Code = fiber.StatusBadRequest
+		p.Message = "invalid request body: " + err.Error()
+	case errors.As(err, &typ):
+		p.Code = fiber.StatusBadRequest
+		p.Message = "invalid request body"
+		p.Errors = []*common.FieldError{{Field: typ.Field, Message: "must be of type " + typ.Type.String()}}
+	}
+	// server errors may contain internals, the details are only logged
+	if p.Code >= fiber.StatusInternalServerError {
+		p.Message = utils.StatusMessage(p.Code)
+	}
+	return
+}
+
+// errorStatus returns the status code of the response for the error
+func errorStatus(err error) int {
+	return newProblem(err).Code
+}
+
+// errorHandler writes errors returned by handlers as problem documents
+func (s *Server) errorHandler(ctx *fiber.Ctx, err error) error {
+	p := newProblem(err)
+	p.RequestID = ctx.GetRespHeader(fiber.HeaderXRequestID)
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		ctx.Set(fiber.HeaderRetryAfter, retryAfterSeconds(rl.RetryAfter))
+	}
+	if p.Code >= fiber.StatusInternalServerError {
+		log.WithError(err).Warnf("[%s] %s %s failed", p.RequestID, ctx.Method(), ctx.OriginalURL())
+	}
+	return ctx.Status(p.Code).JSON(p)
+}
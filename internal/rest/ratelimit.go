@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"github.com/ICBX/penguin/internal/ratelimit"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RateLimits configures the limits of the API, zero values disable a limit
+type RateLimits struct {
+	// IPInterval and IPBurst limit all requests per client address
+	IPInterval time.Duration
+	IPBurst    int
+	// BlobberInterval and BlobberBurst limit the requests per blobber credential
+	BlobberInterval time.Duration
+	BlobberBurst    int
+	// PullInterval is the ideal poll interval which is sent to blobbers,
+	// a blobber may pull PullBurst times at once and once more every PullInterval
+	PullInterval time.Duration
+	PullBurst    int
+	// MaxBadSecrets wrong blobber secrets within BadSecretWindow lock out the client address
+	// from the blobber for LockoutDuration, a correct secret forgets the previous failures
+	MaxBadSecrets   int
+	BadSecretWindow time.Duration
+	LockoutDuration time.Duration
+}
+
+// DefaultRateLimits are generous enough for every well-behaved client
+var DefaultRateLimits = RateLimits{
+	IPInterval:      10 * time.Millisecond,
+	IPBurst:         200,
+	BlobberInterval: 100 * time.Millisecond,
+	BlobberBurst:    100,
+	PullInterval:    30 * time.Second,
+	PullBurst:       5,
+	MaxBadSecrets:   10,
+	BadSecretWindow: 15 * time.Minute,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// limiters are created from the RateLimits of the server
+type limiters struct {
+	ip         *ratelimit.Limiter
+	blobber    *ratelimit.Limiter
+	pull       *ratelimit.Limiter
+	badSecrets *ratelimit.Lockout
+}
+
+func newLimiters(l RateLimits) *limiters {
+	return &limiters{
+		ip:         ratelimit.NewLimiter(l.IPInterval, l.IPBurst),
+		blobber:    ratelimit.NewLimiter(l.BlobberInterval, l.BlobberBurst),
+		pull:       ratelimit.NewLimiter(l.PullInterval, l.PullBurst),
+		badSecrets: ratelimit.NewLockout(l.MaxBadSecrets, l.BadSecretWindow, l.LockoutDuration),
+	}
+}
+
+// RateLimitError is returned if a client exceeded a limit and is answered with 429 Too Many Requests
+type RateLimitError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Message
+}
+
+// retryAfterSeconds formats the delay for the Retry-After header, rounded up to whole seconds
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// rateLimitMiddleware limits the requests per client address
+func (s *Server) rateLimitMiddleware(ctx *fiber.Ctx) error {
+	if ok, retry := s.limiters.ip.Allow(utils.CopyString(ctx.IP()), time.Now()); !ok {
+		return &RateLimitError{Message: "too many requests", RetryAfter: retry}
+	}
+	return ctx.Next()
+}
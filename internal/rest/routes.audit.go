@@ -0,0 +1,83 @@
+package rest
+
+import (
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+type auditLogResponse struct {
+	ID        uint            `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"requestID"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+func newAuditLogResponse(l *common.AuditLog) auditLogResponse {
+	res := auditLogResponse{
+		ID:        l.ID,
+		Time:      l.Time,
+		Actor:     l.Actor,
+		IP:        l.IP,
+		RequestID: l.RequestID,
+		Action:    l.Action,
+		Target:    l.Target,
+		Reason:    l.Reason,
+	}
+	if l.Before != "" {
+		res.Before = json.RawMessage(l.Before)
+	}
+	if l.After != "" {
+		res.After = json.RawMessage(l.After)
+	}
+	return res
+}
+
+// GET /audit?actor=<actor>&action=<action>&target=<target>&since=<RFC 3339>&limit=100&offset=0
+// lists the audit log, newest entries first
+func (s *Server) routeAuditList(ctx *fiber.Ctx) (err error) {
+	limit, err := strconv.Atoi(ctx.Query("limit", "100"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid limit")
+	}
+	offset, err := strconv.Atoi(ctx.Query("offset", "0"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid offset")
+	}
+
+	tx := s.db.Model(&common.AuditLog{})
+	if a := ctx.Query("actor"); a != "" {
+		tx = tx.Where("actor = ?", a)
+	}
+	if a := ctx.Query("action"); a != "" {
+		tx = tx.Where("action = ?", a)
+	}
+	if t := ctx.Query("target"); t != "" {
+		tx = tx.Where("target = ?", t)
+	}
+	if since := ctx.Query("since"); since != "" {
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, since); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid since")
+		}
+		tx = tx.Where("time >= ?", t)
+	}
+
+	var logs []*common.AuditLog
+	if err = tx.Order("id DESC").Limit(limit).Offset(offset).Find(&logs).Error; err != nil {
+		return
+	}
+	res := make([]auditLogResponse, len(logs))
+	for i, l := range logs {
+		res[i] = newAuditLogResponse(l)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
@@ -9,6 +9,13 @@ import (
 type newBlobberPayload struct {
 	Name   string `json:"name"`
 	Secret string `json:"secret"`
+	// PublicURL is the base URL of the endpoint which serves the blobs (optional)
+	PublicURL string `json:"publicURL"`
+}
+
+type blobberResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
 }
 
 func (s *Server) routeBlobberAdd(ctx *fiber.Ctx) (err error) {
@@ -17,19 +24,35 @@ func (s *Server) routeBlobberAdd(ctx *fiber.Ctx) (err error) {
 		return
 	}
 
+	var verr common.ValidationError
 	if req.Name == "" {
-		return fiber.NewError(fiber.StatusBadGateway, "name required")
+		verr.Add("name", "required")
 	}
 	if req.Secret == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "secret required")
+		verr.Add("secret", "required")
+	}
+	if req.PublicURL, err = normalizePublicURL(req.PublicURL); err != nil {
+		verr.Add("publicURL", err.Error())
+	}
+	if err = verr.Err(); err != nil {
+		return
 	}
 
-	if err = s.db.Create(&common.BlobDownloader{
-		Name:   req.Name,
-		Secret: req.Secret,
-	}).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	blobber := &common.BlobDownloader{
+		Name:      req.Name,
+		Secret:    req.Secret,
+		PublicURL: req.PublicURL,
+	}
+	if err = s.db.Create(blobber).Error; err != nil {
+		return
 	}
 
-	return ctx.Status(201).SendString("")
+	audit(ctx, "blobber.add", auditTarget("blobber", blobber.ID), nil, fiber.Map{
+		"name":      blobber.Name,
+		"publicURL": blobber.PublicURL,
+	})
+	return ctx.Status(fiber.StatusCreated).JSON(blobberResponse{
+		ID:   blobber.ID,
+		Name: blobber.Name,
+	})
 }
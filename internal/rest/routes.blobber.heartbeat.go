@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// BlobberHeartbeatPayload is sent periodically by every blobber
+type BlobberHeartbeatPayload struct {
+	Version string `json:"version"`
+	// TotalBytes and FreeBytes are the capacity of the storage of the blobber, if known
+	TotalBytes int64 `json:"totalBytes"`
+	FreeBytes  int64 `json:"freeBytes"`
+}
+
+type BlobberHeartbeatResponse struct {
+	Time time.Time `json:"time"`
+	// Full blobbers don't receive downloads until they have free capacity again
+	Full     bool     `json:"full"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// POST /blobber/:blobber_id/heartbeat
+func (s *Server) routeBlobberHeartbeat(ctx *fiber.Ctx) (err error) {
+	var blobber *common.BlobDownloader
+	if blobber, err = s.authBlobber(ctx); err != nil {
+		return
+	}
+
+	var req BlobberHeartbeatPayload
+	if len(ctx.Body()) > 0 {
+		if err = ctx.BodyParser(&req); err != nil {
+			return
+		}
+	}
+
+	var verr common.ValidationError
+	if req.TotalBytes < 0 {
+		verr.Add("totalBytes", "must not be negative")
+	}
+	if req.FreeBytes < 0 || req.FreeBytes > req.TotalBytes {
+		verr.Add("freeBytes", "must be between 0 and totalBytes")
+	}
+	if err = verr.Err(); err != nil {
+		return
+	}
+
+	now := time.Now()
+	update := map[string]interface{}{
+		"last_seen": sql.NullTime{Valid: true, Time: now},
+	}
+	if req.Version != "" {
+		update["version"] = req.Version
+	}
+	if req.TotalBytes > 0 {
+		update["total_bytes"], update["free_bytes"] = req.TotalBytes, req.FreeBytes
+		blobber.TotalBytes, blobber.FreeBytes = req.TotalBytes, req.FreeBytes
+	}
+	if err = s.db.Model(blobber).Updates(update).Error; err != nil {
+		return
+	}
+
+	var c *tasks.Capacity
+	if c, err = tasks.BlobberCapacity(s.db, blobber); err != nil {
+		return
+	}
+	for _, w := range c.Warnings {
+		log.Warnf("Blobber '%s' (%d): %s", blobber.Name, blobber.ID, w)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(BlobberHeartbeatResponse{
+		Time:     now,
+		Full:     c.Full,
+		Warnings: c.Warnings,
+	})
+}
+
+// touchBlobber updates the last seen timestamp of the blobber
+func (s *Server) touchBlobber(blobber *common.BlobDownloader) error {
+	return s.db.Model(blobber).Update("last_seen", sql.NullTime{Valid: true, Time: time.Now()}).Error
+}
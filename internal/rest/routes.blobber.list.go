@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// blobberStatusResponse describes a blobber including its storage capacity
+type blobberStatusResponse struct {
+	ID       uint       `json:"id"`
+	Name     string     `json:"name"`
+	Version  string     `json:"version,omitempty"`
+	LastSeen *time.Time `json:"lastSeen"`
+	// PublicURL is the base URL of the endpoint which serves the blobs
+	PublicURL string `json:"publicURL,omitempty"`
+
+	TotalBytes    int64    `json:"totalBytes"`
+	FreeBytes     int64    `json:"freeBytes"`
+	MaxUsageBytes int64    `json:"maxUsageBytes"`
+	UsedBytes     int64    `json:"usedBytes"`
+	PendingBytes  int64    `json:"pendingBytes"`
+	Full          bool     `json:"full"`
+	Warnings      []string `json:"warnings"`
+}
+
+func (s *Server) newBlobberStatusResponse(b *common.BlobDownloader) (res *blobberStatusResponse, err error) {
+	var c *tasks.Capacity
+	if c, err = tasks.BlobberCapacity(s.db, b); err != nil {
+		return
+	}
+	res = &blobberStatusResponse{
+		ID:            b.ID,
+		Name:          b.Name,
+		Version:       b.Version,
+		PublicURL:     b.PublicURL,
+		TotalBytes:    b.TotalBytes,
+		FreeBytes:     b.FreeBytes,
+		MaxUsageBytes: b.MaxUsageBytes,
+		UsedBytes:     c.UsedBytes,
+		PendingBytes:  c.PendingBytes,
+		Full:          c.Full,
+		Warnings:      c.Warnings,
+	}
+	if res.Warnings == nil {
+		res.Warnings = []string{}
+	}
+	if b.LastSeen.Valid {
+		res.LastSeen = &b.LastSeen.Time
+	}
+	return
+}
+
+// GET /blobber
+// lists all blobbers with their capacity
+func (s *Server) routeBlobberList(ctx *fiber.Ctx) (err error) {
+	var blobbers []*common.BlobDownloader
+	if err = s.db.Order("id").Find(&blobbers).Error; err != nil {
+		return
+	}
+	res := make([]*blobberStatusResponse, len(blobbers))
+	for i, b := range blobbers {
+		if res[i], err = s.newBlobberStatusResponse(b); err != nil {
+			return
+		}
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+// BlobberProgressPayload is sent by a blobber while it processes a job
+type BlobberProgressPayload struct {
+	VideoID string             `json:"videoID"`
+	Action  common.QueueAction `json:"action"`
+	Type    common.BlobType    `json:"type"`
+	// Stage is a free-form description like downloading or uploading
+	Stage      string `json:"stage"`
+	BytesDone  int64  `json:"bytesDone"`
+	BytesTotal int64  `json:"bytesTotal"`
+	// ETA is the estimated remaining time in seconds
+	ETA int64 `json:"eta"`
+}
+
+// POST /blobber/:blobber_id/progress
+func (s *Server) routeBlobberProgress(ctx *fiber.Ctx) (err error) {
+	var blobber *common.BlobDownloader
+	if blobber, err = s.authBlobber(ctx); err != nil {
+		return
+	}
+
+	var req BlobberProgressPayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+	if err = s.storeProgress(blobber, &req); err != nil {
+		return
+	}
+	return ctx.Status(fiber.StatusOK).SendString("progress received")
+}
+
+// storeProgress updates the progress of the queued job
+func (s *Server) storeProgress(blobber *common.BlobDownloader, req *BlobberProgressPayload) (err error) {
+	if req.Type == 0 {
+		req.Type = common.VideoBlobType
+	}
+	if req.Action == 0 {
+		req.Action = common.GetBlob
+	}
+
+	var verr common.ValidationError
+	if req.VideoID == "" {
+		verr.Add("videoID", "required")
+	}
+	if req.BytesDone < 0 {
+		verr.Add("bytesDone", "must not be negative")
+	}
+	if req.BytesTotal < 0 {
+		verr.Add("bytesTotal", "must not be negative")
+	}
+	if req.ETA < 0 {
+		verr.Add("eta", "must not be negative")
+	}
+	if err = verr.Err(); err != nil {
+		return
+	}
+
+	now := time.Now()
+	res := s.db.Model(&common.Queue{}).Where(&common.Queue{
+		VideoID:   req.VideoID,
+		BlobberID: blobber.ID,
+		Action:    req.Action,
+		Type:      req.Type,
+	}).Updates(map[string]interface{}{
+		"stage":       req.Stage,
+		"bytes_done":  req.BytesDone,
+		"bytes_total": req.BytesTotal,
+		"eta":         req.ETA,
+		"progress_at": sql.NullTime{Valid: true, Time: now},
+	})
+	if err = res.Error; err != nil {
+		return
+	}
+	if res.RowsAffected == 0 {
+		return &common.NotFoundError{Resource: "job", ID: req.Action.String() + " " + req.Type.String() + " " + req.VideoID}
+	}
+
+	events.Publish(events.QueueProgress, req.VideoID, events.QueueJobProgress{
+		QueueJob: events.QueueJob{
+			BlobberID: blobber.ID,
+			Action:    req.Action.String(),
+			Type:      req.Type.String(),
+		},
+		Stage:      req.Stage,
+		BytesDone:  req.BytesDone,
+		BytesTotal: req.BytesTotal,
+		ETA:        req.ETA,
+	})
+	return
+}
+
+// queueItemResponse is a queued job including its progress
+type queueItemResponse struct {
+	VideoID   string             `json:"videoID"`
+	BlobberID uint               `json:"blobberID"`
+	Action    common.QueueAction `json:"action"`
+	Type      common.BlobType    `json:"type"`
+	AckedAt   *time.Time         `json:"ackedAt,omitempty"`
+	Progress  *queueProgress     `json:"progress,omitempty"`
+}
+
+type queueProgress struct {
+	Stage      string    `json:"stage,omitempty"`
+	BytesDone  int64     `json:"bytesDone"`
+	BytesTotal int64     `json:"bytesTotal,omitempty"`
+	ETA        int64     `json:"eta,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func newQueueItemResponse(q *common.Queue) (res queueItemResponse) {
+	res = queueItemResponse{
+		VideoID:   q.VideoID,
+		BlobberID: q.BlobberID,
+		Action:    q.Action,
+		Type:      q.Type,
+	}
+	if q.AckedAt.Valid {
+		res.AckedAt = &q.AckedAt.Time
+	}
+	if q.ProgressAt.Valid {
+		res.Progress = &queueProgress{
+			Stage:      q.Stage,
+			BytesDone:  q.BytesDone,
+			BytesTotal: q.BytesTotal,
+			ETA:        q.ETA,
+			UpdatedAt:  q.ProgressAt.Time,
+		}
+	}
+	return
+}
+
+// GET /queue?blobber=1&video=abc&active=yes&limit=100&offset=0
+// lists queued jobs, active=yes only returns jobs with progress
+func (s *Server) routeQueueList(ctx *fiber.Ctx) (err error) {
+	limit, err := strconv.Atoi(ctx.Query("limit", "100"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid limit")
+	}
+	offset, err := strconv.Atoi(ctx.Query("offset", "0"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid offset")
+	}
+
+	tx := s.db.Model(&common.Queue{})
+	if b := ctx.Query("blobber"); b != "" {
+		var id uint
+		if id, err = convertStringToUint(b); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid blobber")
+		}
+		tx = tx.Where("blobber_id = ?", id)
+	}
+	if v := ctx.Query("video"); v != "" {
+		tx = tx.Where("video_id = ?", v)
+	}
+	if ctx.Query("active") == "yes" {
+		tx = tx.Where("progress_at IS NOT NULL")
+	}
+
+	var queue []*common.Queue
+	if err = tx.Order("video_id, blobber_id, action, type").Limit(limit).Offset(offset).Find(&queue).Error; err != nil {
+		return
+	}
+	res := make([]queueItemResponse, len(queue))
+	for i, q := range queue {
+		res[i] = newQueueItemResponse(q)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
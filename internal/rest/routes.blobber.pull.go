@@ -2,74 +2,143 @@ package rest
 
 import (
 	"errors"
+	"github.com/ICBX/penguin/internal/metrics"
 	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/utils"
 	"gorm.io/gorm"
+	"math"
 	"strconv"
+	"time"
 )
 
+// BlobberJob is a single job from the queue of a blobber
+type BlobberJob struct {
+	VideoID string             `json:"videoID"`
+	Action  common.QueueAction `json:"action"`
+	Type    common.BlobType    `json:"type"`
+}
+
 type BlobberPullResponse struct {
-	Download []string `json:"download"`
-	Remove   []string `json:"remove"`
+	// Download and Remove only contain video blobs,
+	// Jobs contains all jobs including other blob types
+	Download []string     `json:"download"`
+	Remove   []string     `json:"remove"`
+	Jobs     []BlobberJob `json:"jobs"`
+	// PollInterval is the ideal delay until the next pull in seconds
+	PollInterval int `json:"pollInterval,omitempty"`
 }
 
 func (s *Server) routeBlobberPull(ctx *fiber.Ctx) (err error) {
+	var blobber *common.BlobDownloader
+	if blobber, err = s.authBlobber(ctx); err != nil {
+		return
+	}
+	blobberIDUint := blobber.ID
+	if ok, retry := s.limiters.pull.Allow(strconv.FormatUint(uint64(blobberIDUint), 10), time.Now()); !ok {
+		return &RateLimitError{Message: "pulling too often, use the socket or the pollInterval", RetryAfter: retry}
+	}
+	if err = s.touchBlobber(blobber); err != nil {
+		return
+	}
+	metrics.BlobberPulls.WithLabelValues(strconv.FormatUint(uint64(blobberIDUint), 10)).Inc()
+
+	var jobs []BlobberJob
+	if jobs, err = s.blobberJobs(s.db.Where(&common.Queue{BlobberID: blobberIDUint})); err != nil {
+		return
+	}
+
+	// collect video ids to download and remove
+	res := BlobberPullResponse{
+		Download: []string{},
+		Remove:   []string{},
+		Jobs:     jobs,
+	}
+	if s.limits.PullInterval > 0 {
+		res.PollInterval = int(math.Ceil(s.limits.PullInterval.Seconds()))
+	}
+	for _, j := range jobs {
+		if j.Type != common.VideoBlobType {
+			continue
+		}
+		switch j.Action {
+		case common.GetBlob:
+			res.Download = append(res.Download, j.VideoID)
+		case common.RemoveBlob:
+			res.Remove = append(res.Remove, j.VideoID)
+		}
+	}
+
+	err = ctx.Status(fiber.StatusOK).JSON(res)
+	return
+}
+
+// blobberJobs returns the queued jobs matched by query,
+// downloads of disabled videos are paused until the video is enabled again
+func (s *Server) blobberJobs(query *gorm.DB) (jobs []BlobberJob, err error) {
+	var queue []*common.Queue
+	if err = query.
+		Where("action <> ? OR video_id IN (?)", common.GetBlob, s.db.Model(&common.Video{}).Select("id")).
+		Find(&queue).Error; err != nil {
+		return
+	}
+	jobs = make([]BlobberJob, len(queue))
+	for i, q := range queue {
+		jobs[i] = BlobberJob{
+			VideoID: q.VideoID,
+			Action:  q.Action,
+			Type:    q.Type,
+		}
+	}
+	return
+}
+
+// authBlobber checks the blobber id from the route and the secret from the headers
+// and returns the authenticated blobber
+func (s *Server) authBlobber(ctx *fiber.Ctx) (blobber *common.BlobDownloader, err error) {
 	// get blobber id from route
 	blobberID := utils.CopyString(ctx.Params(BlobberIDKey))
 	if blobberID == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Blobber ID is required")
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Blobber ID is required")
 	}
 	var blobberIDUint uint
 	if blobberIDUint, err = convertStringToUint(blobberID); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
 	// get blobber secret from headers
 	blobberSecret := ctx.Get("Blobber-Secret")
 	if blobberSecret == "" {
-		return fiber.NewError(fiber.StatusUnauthorized, "no blobberID specified")
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Blobber-Secret header required")
+	}
+
+	// client addresses with too many wrong secrets are locked out of the blobber,
+	// the blobber id is part of the key because clients behind a proxy share an address
+	key, now := utils.CopyString(ctx.IP())+"/"+strconv.FormatUint(uint64(blobberIDUint), 10), time.Now()
+	if retry := s.limiters.badSecrets.Locked(key, now); retry > 0 {
+		return nil, &RateLimitError{Message: "too many invalid secrets", RetryAfter: retry}
 	}
 
 	// check if blobber id exists and secret is correct
+	blobber = new(common.BlobDownloader)
 	if err = s.db.Where(&common.BlobDownloader{
 		ID:     blobberIDUint,
 		Secret: blobberSecret,
-	}).First(&common.BlobDownloader{}).Error; err != nil {
+	}).First(blobber).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fiber.NewError(fiber.StatusUnauthorized, "invalid blobberID or secret")
+			if s.limiters.badSecrets.Fail(key, now) {
+				log.Warnf("Locked out %s of blobber %d after too many invalid secrets", ctx.IP(), blobberIDUint)
+			}
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "invalid blobberID or secret")
 		}
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
-	}
-
-	// return a list of videos to download
-	var download []*common.Queue
-	if err = s.db.Where(&common.Queue{BlobberID: blobberIDUint, Action: common.GetBlob}).Find(&download).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
-	}
-
-	// return a list of videos to remove
-	var remove []*common.Queue
-	if err = s.db.Where(&common.Queue{BlobberID: blobberIDUint, Action: common.RemoveBlob}).Find(&remove).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
-	}
-
-	// collect video ids to download
-	var videoIDsDownload = make([]string, len(download))
-	for i, q := range download {
-		videoIDsDownload[i] = q.VideoID
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
 	}
+	s.limiters.badSecrets.Reset(key)
 
-	// collect video ids to remove
-	var videoIDsRemove = make([]string, len(remove))
-	for i, q := range remove {
-		videoIDsRemove[i] = q.VideoID
+	if ok, retry := s.limiters.blobber.Allow(strconv.FormatUint(uint64(blobber.ID), 10), now); !ok {
+		return nil, &RateLimitError{Message: "too many requests of blobber", RetryAfter: retry}
 	}
-
-	err = ctx.Status(fiber.StatusOK).JSON(BlobberPullResponse{
-		Download: videoIDsDownload,
-		Remove:   videoIDsRemove,
-	})
 	return
 }
 
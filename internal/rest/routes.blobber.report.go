@@ -0,0 +1,221 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// BlobberReportPayload is sent by a blobber after it finished a job from the queue
+type BlobberReportPayload struct {
+	VideoID string             `json:"videoID"`
+	Action  common.QueueAction `json:"action"`
+	Type    common.BlobType    `json:"type"`
+	// Path is the location of the stored blob on the blobber (only for GetBlob)
+	Path string `json:"path"`
+	// Checksum is the SHA-256 hash of the stored blob (GetBlob and VerifyBlob)
+	Checksum string `json:"checksum,omitempty"`
+	// Size is the size of all files of the blob in bytes (only for GetBlob)
+	Size int64 `json:"size,omitempty"`
+	// Missing is set if the blob to verify wasn't found (only for VerifyBlob)
+	Missing bool `json:"missing,omitempty"`
+}
+
+func (s *Server) routeBlobberReport(ctx *fiber.Ctx) (err error) {
+	var blobber *common.BlobDownloader
+	if blobber, err = s.authBlobber(ctx); err != nil {
+		return
+	}
+
+	var req BlobberReportPayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+	if err = s.reportJob(blobber, &req); err != nil {
+		return
+	}
+	return ctx.Status(fiber.StatusCreated).SendString("report received")
+}
+
+// reportJob stores the result of a finished job and removes it from the queue of the blobber
+func (s *Server) reportJob(blobber *common.BlobDownloader, req *BlobberReportPayload) (err error) {
+	if req.Type == 0 {
+		req.Type = common.VideoBlobType
+	}
+
+	var verr common.ValidationError
+	if req.VideoID == "" {
+		verr.Add("videoID", "required")
+	}
+	switch req.Action {
+	case common.GetBlob:
+		if req.Path == "" {
+			verr.Add("path", "required")
+		}
+	case common.VerifyBlob:
+		if req.Checksum == "" && !req.Missing {
+			verr.Add("checksum", "required")
+		}
+	case common.RemoveBlob:
+	default:
+		verr.Add("action", "invalid action")
+	}
+	if err = verr.Err(); err != nil {
+		return
+	}
+
+	var (
+		completed bool
+		status    string
+	)
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		switch req.Action {
+		case common.GetBlob:
+			// repeated reports (e.g. over the socket and http) replace the location
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "video_id"}, {Name: "blob_downloader_id"}, {Name: "type"}},
+				DoUpdates: clause.AssignmentColumns([]string{"path", "added_at", "checksum", "verified_at", "size"}),
+			}).Create(&common.BlobLocation{
+				VideoID:          req.VideoID,
+				BlobDownloaderID: blobber.ID,
+				Path:             req.Path,
+				AddedAt:          time.Now(),
+				Type:             req.Type,
+				Checksum:         req.Checksum,
+				VerifiedAt:       verifiedAt(req.Checksum),
+				Size:             req.Size,
+			}).Error
+		case common.VerifyBlob:
+			status, err = verifyBlob(tx, blobber, req)
+		case common.RemoveBlob:
+			err = tx.Where(&common.BlobLocation{
+				VideoID:          req.VideoID,
+				BlobDownloaderID: blobber.ID,
+				Type:             req.Type,
+			}).Delete(&common.BlobLocation{}).Error
+		}
+		if err != nil {
+			return
+		}
+
+		// remove finished job from queue
+		res := tx.Where(&common.Queue{
+			VideoID:   req.VideoID,
+			BlobberID: blobber.ID,
+			Action:    req.Action,
+			Type:      req.Type,
+		}).Delete(&common.Queue{})
+		completed = res.RowsAffected > 0
+		return res.Error
+	}); err != nil {
+		return
+	}
+
+	log.Infof("Blobber '%s' (%d) reported %s of video %s", blobber.Name, blobber.ID, req.Action, req.VideoID)
+
+	switch status {
+	case "":
+	case blobOK:
+		events.Publish(events.BlobVerified, req.VideoID, events.BlobVerification{
+			BlobberID: blobber.ID,
+			Type:      req.Type.String(),
+			Status:    status,
+		})
+	default:
+		log.Warnf("Blob %s of video %s on blobber '%s' (%d) is %s, downloading again",
+			req.Type, req.VideoID, blobber.Name, blobber.ID, status)
+		events.Publish(events.BlobDamaged, req.VideoID, events.BlobVerification{
+			BlobberID: blobber.ID,
+			Type:      req.Type.String(),
+			Status:    status,
+		})
+	}
+
+	if completed {
+		events.Publish(events.QueueCompleted, req.VideoID, events.QueueJob{
+			BlobberID: blobber.ID,
+			Action:    req.Action.String(),
+			Type:      req.Type.String(),
+		})
+	}
+	if req.Action == common.GetBlob {
+		events.Publish(events.VideoArchived, req.VideoID, fiber.Map{
+			"blobberID": blobber.ID,
+			"type":      req.Type,
+			"path":      req.Path,
+		})
+	}
+	return
+}
+
+// results of blob verifications
+const (
+	blobOK      = "ok"
+	blobMissing = "missing"
+	blobCorrupt = "corrupt"
+)
+
+// verifyBlob compares the verification report of the blobber with the recorded checksums.
+// Missing and corrupt blobs lose their location and are downloaded again by the blobber.
+func verifyBlob(tx *gorm.DB, blobber *common.BlobDownloader, req *BlobberReportPayload) (status string, err error) {
+	where := &common.BlobLocation{
+		VideoID:          req.VideoID,
+		BlobDownloaderID: blobber.ID,
+		Type:             req.Type,
+	}
+	var locations []*common.BlobLocation
+	if err = tx.Where(where).Find(&locations).Error; err != nil {
+		return
+	}
+	// the location was removed in the meantime
+	if len(locations) == 0 {
+		return
+	}
+
+	status = blobOK
+	if req.Missing {
+		status = blobMissing
+	} else {
+		for _, l := range locations {
+			// blobs downloaded before checksums were recorded are trusted on their first verification
+			if l.Checksum != "" && l.Checksum != req.Checksum {
+				status = blobCorrupt
+			}
+		}
+	}
+
+	if status == blobOK {
+		err = tx.Model(&common.BlobLocation{}).Where(where).Updates(&common.BlobLocation{
+			Checksum:   req.Checksum,
+			VerifiedAt: verifiedAt(req.Checksum),
+		}).Error
+		return
+	}
+
+	if err = tx.Where(where).Delete(&common.BlobLocation{}).Error; err != nil {
+		return
+	}
+	// disabled videos are downloaded again as soon as they are enabled
+	if _, err = tasks.Enqueue(tx, &common.Queue{
+		VideoID:   req.VideoID,
+		BlobberID: blobber.ID,
+		Action:    common.GetBlob,
+		Type:      req.Type,
+	}); errors.Is(err, common.ErrBlobberFull) {
+		log.WithError(err).Warnf("Cannot download %s of video %s again", req.Type, req.VideoID)
+		err = nil
+	}
+	return
+}
+
+// verifiedAt returns the current time if the checksum is known
+func verifiedAt(checksum string) sql.NullTime {
+	return sql.NullTime{Valid: checksum != "", Time: time.Now()}
+}
@@ -0,0 +1,276 @@
+package rest
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// message types of the blobber socket
+const (
+	// SocketJobs is sent by the controller with queued jobs, the blobber acknowledges them with SocketAck
+	SocketJobs = "jobs"
+	// SocketAck, SocketProgress and SocketReport are sent by the blobber
+	SocketAck      = "ack"
+	SocketProgress = "progress"
+	SocketReport   = "report"
+	// SocketResult is the answer to every message of the blobber
+	SocketResult = "result"
+)
+
+const (
+	socketPingInterval = 30 * time.Second
+	// socketResyncInterval is the interval in which unacknowledged jobs are pushed again
+	socketResyncInterval = time.Minute
+	socketWriteTimeout   = 10 * time.Second
+
+	blobberLocal = "blobber"
+)
+
+// BlobberSocketMessage is exchanged over the blobber socket
+type BlobberSocketMessage struct {
+	Type string `json:"type"`
+	// ID is set by the blobber and copied to the result
+	ID string `json:"id,omitempty"`
+
+	// Jobs are pushed (SocketJobs) or acknowledged (SocketAck)
+	Jobs     []BlobberJob            `json:"jobs,omitempty"`
+	Progress *BlobberProgressPayload `json:"progress,omitempty"`
+	Report   *BlobberReportPayload   `json:"report,omitempty"`
+
+	// Error is set in results of failed messages
+	Error *problemResponse `json:"error,omitempty"`
+}
+
+// GET /blobber/:blobber_id/socket
+// authenticates the blobber before the connection is upgraded
+func (s *Server) routeBlobberSocketUpgrade(ctx *fiber.Ctx) (err error) {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.NewError(fiber.StatusUpgradeRequired, "websocket upgrade required")
+	}
+	var blobber *common.BlobDownloader
+	if blobber, err = s.authBlobber(ctx); err != nil {
+		return
+	}
+	if err = s.touchBlobber(blobber); err != nil {
+		return
+	}
+	ctx.Locals(blobberLocal, blobber)
+	return ctx.Next()
+}
+
+// blobberSocket serializes writes to the connection
+type blobberSocket struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (b *blobberSocket) send(msg *BlobberSocketMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = b.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return b.conn.WriteJSON(msg)
+}
+
+func (b *blobberSocket) ping() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout))
+}
+
+// routeBlobberSocket pushes the queue of the blobber and jobs as soon as they are enqueued.
+// Blobbers which can't keep a socket open use the pull route instead.
+func (s *Server) routeBlobberSocket(conn *websocket.Conn) {
+	blobber := conn.Locals(blobberLocal).(*common.BlobDownloader)
+	sock := &blobberSocket{conn: conn}
+
+	// subscribe before the queue is pushed, so no job is missed
+	evs, cancel := s.bus.Subscribe(128)
+	defer cancel()
+
+	log.Infof("Blobber '%s' (%d) connected to socket", blobber.Name, blobber.ID)
+	defer log.Infof("Blobber '%s' (%d) disconnected from socket", blobber.Name, blobber.ID)
+
+	if err := s.pushJobs(sock, s.db.Where(&common.Queue{BlobberID: blobber.ID})); err != nil {
+		log.WithError(err).Warnf("cannot push queue to blobber %d", blobber.ID)
+		return
+	}
+
+	// connections without pongs are closed
+	_ = conn.SetReadDeadline(time.Now().Add(2 * socketPingInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * socketPingInterval))
+	})
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var msg BlobberSocketMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if err := sock.send(s.handleSocketMessage(blobber, &msg)); err != nil {
+				return
+			}
+		}
+	}()
+	// the connection is reused after the handler returns, so the reader has to be stopped first
+	defer func() {
+		_ = conn.Close()
+		<-closed
+	}()
+
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+	resync := time.NewTicker(socketResyncInterval)
+	defer resync.Stop()
+
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		case <-ping.C:
+			err = sock.ping()
+		case <-resync.C:
+			if err = s.touchBlobber(blobber); err == nil {
+				err = s.pushJobs(sock, s.db.Where(&common.Queue{BlobberID: blobber.ID}).Where("acked_at IS NULL"))
+			}
+		case e, ok := <-evs:
+			if !ok {
+				return
+			}
+			err = s.pushEvent(sock, blobber, e)
+		}
+		if err != nil {
+			log.WithError(err).Warnf("closing socket of blobber %d", blobber.ID)
+			return
+		}
+	}
+}
+
+// pushJobs sends the queued jobs matched by query
+func (s *Server) pushJobs(sock *blobberSocket, query *gorm.DB) (err error) {
+	var jobs []BlobberJob
+	if jobs, err = s.blobberJobs(query); err != nil || len(jobs) == 0 {
+		return
+	}
+	return sock.send(&BlobberSocketMessage{Type: SocketJobs, Jobs: jobs})
+}
+
+// pushEvent sends the job of a QueueEnqueued event if it belongs to the blobber.
+// Jobs are announced after the enqueuing transaction was committed (see tasks.Transaction),
+// jobs which were removed from the queue in the meantime are skipped.
+func (s *Server) pushEvent(sock *blobberSocket, blobber *common.BlobDownloader, e events.Event) (err error) {
+	data, ok := e.Data.(events.QueueJob)
+	if e.Type != events.QueueEnqueued || !ok || data.BlobberID != blobber.ID {
+		return
+	}
+	job := BlobberJob{VideoID: e.VideoID}
+	if job.Action, ok = parseQueueAction(data.Action); !ok {
+		return
+	}
+	if job.Type, ok = parseBlobType(data.Type); !ok {
+		return
+	}
+
+	var n int64
+	if err = s.db.Model(&common.Queue{}).Where(&common.Queue{
+		VideoID:   job.VideoID,
+		BlobberID: blobber.ID,
+		Action:    job.Action,
+		Type:      job.Type,
+	}).Count(&n).Error; err == nil && n > 0 && job.Action == common.GetBlob {
+		// downloads of disabled videos are paused
+		err = s.db.Model(&common.Video{}).Where("id = ?", job.VideoID).Count(&n).Error
+	}
+	if err != nil {
+		// the job is pushed again with the next resync
+		log.WithError(err).Warnf("cannot check job of video %s for blobber %d", job.VideoID, blobber.ID)
+		return nil
+	}
+	if n == 0 {
+		return
+	}
+	return sock.send(&BlobberSocketMessage{Type: SocketJobs, Jobs: []BlobberJob{job}})
+}
+
+// handleSocketMessage processes a message of the blobber and returns the result
+func (s *Server) handleSocketMessage(blobber *common.BlobDownloader, msg *BlobberSocketMessage) (res *BlobberSocketMessage) {
+	res = &BlobberSocketMessage{Type: SocketResult, ID: msg.ID}
+
+	var err error
+	switch msg.Type {
+	case SocketAck:
+		err = s.ackJobs(blobber, msg.Jobs)
+	case SocketProgress:
+		if msg.Progress == nil {
+			err = &common.ValidationError{Fields: []*common.FieldError{{Field: "progress", Message: "required"}}}
+			break
+		}
+		err = s.storeProgress(blobber, msg.Progress)
+	case SocketReport:
+		if msg.Report == nil {
+			err = &common.ValidationError{Fields: []*common.FieldError{{Field: "report", Message: "required"}}}
+			break
+		}
+		err = s.reportJob(blobber, msg.Report)
+	default:
+		err = fiber.NewError(fiber.StatusBadRequest, "unknown message type '"+msg.Type+"'")
+	}
+
+	if err != nil {
+		p := newProblem(err)
+		res.Error = &p
+	}
+	return
+}
+
+// ackJobs marks the jobs as received by the blobber
+func (s *Server) ackJobs(blobber *common.BlobDownloader, jobs []BlobberJob) (err error) {
+	if len(jobs) == 0 {
+		return &common.ValidationError{Fields: []*common.FieldError{{Field: "jobs", Message: "required"}}}
+	}
+	now := sql.NullTime{Valid: true, Time: time.Now()}
+	for _, j := range jobs {
+		if j.Type == 0 {
+			j.Type = common.VideoBlobType
+		}
+		if err = s.db.Model(&common.Queue{}).Where(&common.Queue{
+			VideoID:   j.VideoID,
+			BlobberID: blobber.ID,
+			Action:    j.Action,
+			Type:      j.Type,
+		}).Update("acked_at", now).Error; err != nil {
+			return
+		}
+	}
+	return
+}
+
+func parseQueueAction(s string) (common.QueueAction, bool) {
+	for _, a := range []common.QueueAction{common.GetBlob, common.RemoveBlob, common.VerifyBlob} {
+		if a.String() == s {
+			return a, true
+		}
+	}
+	return 0, false
+}
+
+func parseBlobType(s string) (common.BlobType, bool) {
+	for _, t := range []common.BlobType{common.VideoBlobType, common.ThumbnailBlobType, common.CaptionBlobType} {
+		if t.String() == s {
+			return t, true
+		}
+	}
+	return 0, false
+}
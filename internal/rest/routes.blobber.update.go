@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+)
+
+type blobberUpdatePayload struct {
+	// MaxUsageBytes limits the size of all blobs stored by the blobber, 0 removes the limit
+	MaxUsageBytes int64 `json:"maxUsageBytes"`
+	// PublicURL is the base URL of the endpoint which serves the blobs, empty if the blobs aren't served
+	PublicURL string `json:"publicURL"`
+}
+
+// PUT /blobber/:blobber_id
+func (s *Server) routeBlobberUpdate(ctx *fiber.Ctx) (err error) {
+	blobberID := utils.CopyString(ctx.Params(BlobberIDKey))
+	var id uint
+	if id, err = convertStringToUint(blobberID); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	var req blobberUpdatePayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+	var verr common.ValidationError
+	if req.MaxUsageBytes < 0 {
+		verr.Add("maxUsageBytes", "must not be negative")
+	}
+	if req.PublicURL, err = normalizePublicURL(req.PublicURL); err != nil {
+		verr.Add("publicURL", err.Error())
+	}
+	if err = verr.Err(); err != nil {
+		return
+	}
+
+	blobber := new(common.BlobDownloader)
+	if err = s.db.Where(&common.BlobDownloader{ID: id}).First(blobber).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &common.NotFoundError{Resource: "blobber", ID: blobberID}
+		}
+		return
+	}
+	before := fiber.Map{"maxUsageBytes": blobber.MaxUsageBytes, "publicURL": blobber.PublicURL}
+	blobber.MaxUsageBytes, blobber.PublicURL = req.MaxUsageBytes, req.PublicURL
+	if err = s.db.Model(blobber).Select("MaxUsageBytes", "PublicURL").Updates(blobber).Error; err != nil {
+		return
+	}
+	audit(ctx, "blobber.update", auditTarget("blobber", blobber.ID), before, fiber.Map{
+		"maxUsageBytes": blobber.MaxUsageBytes,
+		"publicURL":     blobber.PublicURL,
+	})
+
+	var res *blobberStatusResponse
+	if res, err = s.newBlobberStatusResponse(blobber); err != nil {
+		return
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
+
+// normalizePublicURL checks that u is an absolute http(s) URL and removes trailing slashes
+func normalizePublicURL(u string) (string, error) {
+	u = strings.TrimRight(strings.TrimSpace(u), "/")
+	if u == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", errors.New("must be an absolute http(s) URL")
+	}
+	return u, nil
+}
@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// GET /media/channel/:channel_id
+func (s *Server) routeChannel(ctx *fiber.Ctx) (err error) {
+	var channel common.Channel
+	if err = s.db.Where(&common.Channel{
+		ID: utils.CopyString(ctx.Params(ChannelIDKey)),
+	}).First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "channel not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(channel)
+}
+
+// GET /media/channel/:channel_id/history
+func (s *Server) routeChannelHistory(ctx *fiber.Ctx) (err error) {
+	var history []*common.ChannelHistory
+	if err = s.db.Where(&common.ChannelHistory{
+		ChannelID: utils.CopyString(ctx.Params(ChannelIDKey)),
+	}).Order("updated_at").Find(&history).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(history)
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// rest payloads
+type collectionPayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type collectionResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Blobbers    []uint    `json:"blobbers"`
+	VideoCount  int64     `json:"videoCount"`
+	// Videos is only set for a single collection
+	Videos []string `json:"videos,omitempty"`
+}
+
+func (s *Server) newCollectionResponse(c *common.Collection, videos bool) (res collectionResponse, err error) {
+	res = collectionResponse{
+		ID:          c.ID,
+		Name:        c.Name,
+		Description: c.Description,
+		CreatedAt:   c.CreatedAt,
+		Blobbers:    []uint{},
+	}
+	for _, b := range c.Blobbers {
+		res.Blobbers = append(res.Blobbers, b.ID)
+	}
+	if videos {
+		res.Videos = []string{}
+		for _, v := range c.Videos {
+			res.Videos = append(res.Videos, v.ID)
+		}
+		res.VideoCount = int64(len(c.Videos))
+	} else {
+		res.VideoCount = s.db.Model(c).Association("Videos").Count()
+	}
+	return
+}
+
+// findCollection returns the collection of the current route
+func (s *Server) findCollection(ctx *fiber.Ctx, preload ...string) (c *common.Collection, err error) {
+	var id uint
+	if id, err = convertStringToUint(utils.CopyString(ctx.Params(CollectionIDKey))); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Could not process collection id")
+	}
+	tx := s.db
+	for _, p := range preload {
+		tx = tx.Preload(p)
+	}
+	c = new(common.Collection)
+	if err = tx.First(c, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "collection not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return
+}
+
+// auditCollectionState returns the state of the collection for the audit log
+func auditCollectionState(c *common.Collection) fiber.Map {
+	return fiber.Map{"name": c.Name, "description": c.Description}
+}
+
+// checkCollectionName returns an error if the name is empty or already used by another collection
+func checkCollectionName(db *gorm.DB, name string, id uint) (err error) {
+	if name == "" {
+		return &common.ValidationError{Fields: []*common.FieldError{{Field: "name", Message: "required"}}}
+	}
+	var count int64
+	if err = db.Model(&common.Collection{}).
+		Where("name = ? AND id <> ?", name, id).
+		Count(&count).Error; err != nil {
+		return
+	}
+	if count > 0 {
+		return &common.ConflictError{Message: "collection already exists"}
+	}
+	return
+}
+
+// POST /collection
+func (s *Server) routeCollectionAdd(ctx *fiber.Ctx) (err error) {
+	var req collectionPayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	c := &common.Collection{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err = s.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err = checkCollectionName(tx, req.Name, 0); err != nil {
+			return
+		}
+		return tx.Create(c).Error
+	}); err != nil {
+		return
+	}
+	audit(ctx, "collection.add", auditTarget("collection", c.ID), nil, auditCollectionState(c))
+
+	res, err := s.newCollectionResponse(c, true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(res)
+}
+
+// GET /collection
+func (s *Server) routeCollectionList(ctx *fiber.Ctx) (err error) {
+	var collections []*common.Collection
+	if err = s.db.Preload("Blobbers").Order("name").Find(&collections).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]collectionResponse, len(collections))
+	for i, c := range collections {
+		if res[i], err = s.newCollectionResponse(c, false); err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		}
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
+
+// GET /collection/:collection_id
+func (s *Server) routeCollection(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx, "Blobbers", "Videos")
+	if err != nil {
+		return
+	}
+	res, err := s.newCollectionResponse(c, true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
+
+// PUT /collection/:collection_id
+func (s *Server) routeCollectionUpdate(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx, "Blobbers", "Videos")
+	if err != nil {
+		return
+	}
+
+	var req collectionPayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	before := auditCollectionState(c)
+	c.Name, c.Description = req.Name, req.Description
+	if err = s.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err = checkCollectionName(tx, req.Name, c.ID); err != nil {
+			return
+		}
+		return tx.Model(c).Select("Name", "Description").Updates(c).Error
+	}); err != nil {
+		return
+	}
+	audit(ctx, "collection.update", auditTarget("collection", c.ID), before, auditCollectionState(c))
+
+	res, err := s.newCollectionResponse(c, true)
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
+
+// DELETE /collection/:collection_id
+// deletes the collection, the videos and their blobbers are kept
+func (s *Server) routeCollectionDelete(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx)
+	if err != nil {
+		return
+	}
+
+	if err = s.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err = tx.Model(c).Association("Videos").Clear(); err != nil {
+			return
+		}
+		if err = tx.Model(c).Association("Blobbers").Clear(); err != nil {
+			return
+		}
+		return tx.Delete(c).Error
+	}); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	audit(ctx, "collection.delete", auditTarget("collection", c.ID), auditCollectionState(c), nil)
+	return ctx.Status(fiber.StatusOK).SendString("collection deleted")
+}
@@ -0,0 +1,178 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+type collectionAssignResponse struct {
+	// Queued is the number of downloads which were added to the queue
+	Queued int `json:"queued"`
+}
+
+// findRouteVideo returns the enabled video of the current route
+func (s *Server) findRouteVideo(ctx *fiber.Ctx) (v *common.Video, err error) {
+	v = new(common.Video)
+	if err = s.db.Where(&common.Video{
+		ID: utils.CopyString(ctx.Params(VideoIDKey)),
+	}).First(v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "video not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return
+}
+
+// findRouteBlobber returns the blobber of the current route
+func (s *Server) findRouteBlobber(ctx *fiber.Ctx) (b *common.BlobDownloader, err error) {
+	var id uint
+	if id, err = convertStringToUint(utils.CopyString(ctx.Params(BlobberIDKey))); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Could not process blobber id")
+	}
+	b = new(common.BlobDownloader)
+	if err = s.db.First(b, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fiber.NewError(fiber.StatusNotFound, "blobber not found")
+		}
+		return nil, fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return
+}
+
+// POST /collection/:collection_id/video/:video_id
+// adds the video to the collection and assigns the blobbers of the collection to the video
+func (s *Server) routeCollectionAddVideo(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx)
+	if err != nil {
+		return
+	}
+	v, err := s.findRouteVideo(ctx)
+	if err != nil {
+		return
+	}
+
+	var res collectionAssignResponse
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		if tx.Model(c).Where("id = ?", v.ID).Association("Videos").Count() > 0 {
+			return &common.ConflictError{Message: "video already in collection"}
+		}
+		if err = tx.Model(c).Association("Blobbers").Find(&c.Blobbers); err != nil {
+			return
+		}
+		if err = tx.Model(c).Omit("Videos.*").Association("Videos").Append(v); err != nil {
+			return
+		}
+		for _, b := range c.Blobbers {
+			var queued bool
+			if queued, err = tasks.AssignBlobber(tx, v, b); err != nil {
+				return
+			}
+			if queued {
+				res.Queued++
+			}
+		}
+		return
+	}); err != nil {
+		return
+	}
+
+	audit(ctx, "collection.video_add", auditTarget("collection", c.ID), nil, fiber.Map{"videoID": v.ID, "queued": res.Queued})
+	return ctx.Status(fiber.StatusCreated).JSON(res)
+}
+
+// DELETE /collection/:collection_id/video/:video_id
+// removes the video from the collection, blobbers assigned by the collection are kept
+func (s *Server) routeCollectionRemoveVideo(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx)
+	if err != nil {
+		return
+	}
+	v, err := s.findRouteVideo(ctx)
+	if err != nil {
+		return
+	}
+
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		if tx.Model(c).Where("id = ?", v.ID).Association("Videos").Count() == 0 {
+			return fiber.NewError(fiber.StatusNotFound, "video not in collection")
+		}
+		return tx.Model(c).Association("Videos").Delete(v)
+	}); err != nil {
+		return
+	}
+
+	audit(ctx, "collection.video_remove", auditTarget("collection", c.ID), fiber.Map{"videoID": v.ID}, nil)
+	return ctx.Status(fiber.StatusOK).SendString("video removed from collection")
+}
+
+// POST /collection/:collection_id/blobber/:blobber_id
+// assigns the blobber to the collection and all of its videos
+func (s *Server) routeCollectionAddBlobber(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx)
+	if err != nil {
+		return
+	}
+	b, err := s.findRouteBlobber(ctx)
+	if err != nil {
+		return
+	}
+
+	var res collectionAssignResponse
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		if tx.Model(c).Where("id = ?", b.ID).Association("Blobbers").Count() > 0 {
+			return &common.ConflictError{Message: "blobber already assigned to collection"}
+		}
+		if err = tx.Model(c).Association("Videos").Find(&c.Videos); err != nil {
+			return
+		}
+		if err = tx.Model(c).Omit("Blobbers.*").Association("Blobbers").Append(b); err != nil {
+			return
+		}
+		for _, v := range c.Videos {
+			var queued bool
+			if queued, err = tasks.AssignBlobber(tx, v, b); err != nil {
+				return
+			}
+			if queued {
+				res.Queued++
+			}
+		}
+		return
+	}); err != nil {
+		return
+	}
+
+	audit(ctx, "collection.blobber_add", auditTarget("collection", c.ID), nil, fiber.Map{"blobberID": b.ID, "queued": res.Queued})
+	return ctx.Status(fiber.StatusCreated).JSON(res)
+}
+
+// DELETE /collection/:collection_id/blobber/:blobber_id
+// stops assigning the blobber to new videos of the collection,
+// use RouteRemoveBlobberFromVideo to remove stored videos from the blobber
+func (s *Server) routeCollectionRemoveBlobber(ctx *fiber.Ctx) (err error) {
+	c, err := s.findCollection(ctx)
+	if err != nil {
+		return
+	}
+	b, err := s.findRouteBlobber(ctx)
+	if err != nil {
+		return
+	}
+
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		if tx.Model(c).Where("id = ?", b.ID).Association("Blobbers").Count() == 0 {
+			return fiber.NewError(fiber.StatusNotFound, "blobber not assigned to collection")
+		}
+		return tx.Model(c).Association("Blobbers").Delete(b)
+	}); err != nil {
+		return
+	}
+
+	audit(ctx, "collection.blobber_remove", auditTarget("collection", c.ID), fiber.Map{"blobberID": b.ID}, nil)
+	return ctx.Status(fiber.StatusOK).SendString("blobber removed from collection")
+}
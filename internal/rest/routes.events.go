@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keepAliveInterval is the interval of comments sent to keep idle connections open
+const keepAliveInterval = 15 * time.Second
+
+// routeEvents streams events as server-sent events.
+// Clients can resume a stream by sending the Last-Event-ID header (or the lastEventId query parameter)
+// and filter events by a comma separated list of types in the types query parameter.
+// If the client missed events (e.g. they are no longer available or the controller restarted),
+// a stream.reset event is sent and clients should refetch their state.
+func (s *Server) routeEvents(ctx *fiber.Ctx) (err error) {
+	var (
+		lastID uint64
+		stale  bool
+	)
+	if last := ctx.Get("Last-Event-ID", ctx.Query("lastEventId")); last != "" {
+		var epoch string
+		if epoch, lastID, err = parseEventID(last); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid Last-Event-ID")
+		}
+		// ids of another run are replaced by the complete history of this run
+		if epoch != s.bus.Epoch() {
+			stale, lastID = true, 0
+		}
+	} else {
+		lastID = s.bus.LastID()
+	}
+
+	var types map[events.Type]bool
+	if t := ctx.Query("types"); t != "" {
+		types = make(map[events.Type]bool)
+		for _, typ := range strings.Split(t, ",") {
+			types[events.Type(strings.TrimSpace(typ))] = true
+		}
+	}
+
+	replay, missed, ch, cancel := s.bus.SubscribeSince(lastID, 64)
+	missed = missed || stale
+
+	ctx.Set(fiber.HeaderContentType, "text/event-stream")
+	ctx.Set(fiber.HeaderCacheControl, "no-cache")
+	ctx.Set(fiber.HeaderConnection, "keep-alive")
+	ctx.Set("X-Accel-Buffering", "no")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		write := func(e events.Event) error {
+			if types != nil && !types[e.Type] && e.Type != events.StreamReset {
+				return nil
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			// the reset has no id, clients keep the id of the last event they received
+			if e.ID > 0 {
+				if _, err = fmt.Fprintf(w, "id: %s-%d\n", s.bus.Epoch(), e.ID); err != nil {
+					return err
+				}
+			}
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return err
+			}
+			return w.Flush()
+		}
+
+		// the headers are only sent with the first write, clients shouldn't wait for the first event
+		if _, err := w.WriteString(": connected\n\n"); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		reset := func() error {
+			return write(events.Event{Type: events.StreamReset, Time: time.Now()})
+		}
+		if missed {
+			if err := reset(); err != nil {
+				return
+			}
+		}
+
+		// last is the id of the last event received from the bus (0 if unknown),
+		// ids are consecutive so a gap means the subscription was too slow and missed events
+		var last uint64
+		if len(replay) > 0 {
+			last = replay[len(replay)-1].ID
+		} else if !missed {
+			last = lastID
+		}
+		for _, e := range replay {
+			if err := write(e); err != nil {
+				return
+			}
+		}
+
+		keepAlive := time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case e, more := <-ch:
+				if !more {
+					return
+				}
+				if last > 0 && e.ID != last+1 {
+					if err := reset(); err != nil {
+						return
+					}
+				}
+				last = e.ID
+				if err := write(e); err != nil {
+					log.WithError(err).Debug("[SSE] client disconnected")
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := w.WriteString(": keep-alive\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return
+}
+
+// parseEventID parses the id of an event sent by routeEvents,
+// ids without epoch (e.g. of older versions) have an empty epoch
+func parseEventID(id string) (epoch string, n uint64, err error) {
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		epoch, id = id[:i], id[i+1:]
+	}
+	n, err = strconv.ParseUint(id, 10, 64)
+	return
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"time"
+)
+
+type healthCheck struct {
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*healthCheck `json:"checks,omitempty"`
+}
+
+// routeHealth reports if the process is alive
+func (s *Server) routeHealth(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(healthResponse{Status: "ok"})
+}
+
+// routeReady reports if the service is ready to serve requests.
+// The YouTube API check is informational only and doesn't affect readiness,
+// since the REST API keeps working even if the quota is exhausted.
+func (s *Server) routeReady(ctx *fiber.Ctx) error {
+	checks := map[string]*healthCheck{
+		"database":   s.checkDatabase(),
+		"migrations": s.checkMigrations(),
+	}
+	cron, update, youtube := s.checkUpdater()
+	checks["cron"] = cron
+	checks["metaUpdate"] = update
+
+	resp := healthResponse{Status: "ok", Checks: checks}
+	status := fiber.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			resp.Status = "unavailable"
+			status = fiber.StatusServiceUnavailable
+		}
+	}
+	checks["youtube"] = youtube
+
+	return ctx.Status(status).JSON(resp)
+}
+
+func (s *Server) checkDatabase() *healthCheck {
+	db, err := s.db.DB()
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return &healthCheck{Error: err.Error()}
+	}
+	return &healthCheck{OK: true}
+}
+
+// checkMigrations checks if every table and column of the models exists
+func (s *Server) checkMigrations() *healthCheck {
+	var missing []string
+	migrator := s.db.Migrator()
+	for _, model := range common.TableModels {
+		stmt := &gorm.Statement{DB: s.db}
+		if err := stmt.Parse(model); err != nil {
+			return &healthCheck{Error: err.Error()}
+		}
+		if !migrator.HasTable(model) {
+			missing = append(missing, stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				missing = append(missing, stmt.Schema.Table+"."+field.DBName)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return &healthCheck{Error: "missing tables or columns", Detail: missing}
+	}
+	return &healthCheck{OK: true}
+}
+
+// checkUpdater returns the checks for the cronjob, the age of the last meta update and the YouTube API
+func (s *Server) checkUpdater() (cron, update, youtube *healthCheck) {
+	if s.status == nil {
+		err := "updater status not available"
+		return &healthCheck{Error: err}, &healthCheck{Error: err}, &healthCheck{Error: err}
+	}
+	st := s.status.Snapshot()
+
+	cron = &healthCheck{OK: st.Running}
+	if !st.Running {
+		cron.Error = "cron not running"
+	}
+
+	update = &healthCheck{OK: true}
+	if st.LastRun.IsZero() {
+		// give the cronjob some time for the first run after startup
+		update.Detail = fiber.Map{"startedAt": st.StartedAt}
+		if time.Since(st.StartedAt) > s.readyThreshold {
+			update.OK = false
+			update.Error = "no meta update since startup"
+		}
+	} else {
+		update.Detail = fiber.Map{
+			"lastRun":  st.LastRun,
+			"duration": st.LastDuration.String(),
+		}
+		if time.Since(st.LastRun) > s.readyThreshold {
+			update.OK = false
+			update.Error = "last meta update is older than " + s.readyThreshold.String()
+		}
+	}
+
+	// only failed API calls make YouTube unreachable, other errors of the run don't
+	youtube = &healthCheck{OK: st.LastAPIErr == nil}
+	if st.LastAPIErr != nil {
+		youtube.Error = st.LastAPIErr.Error()
+	}
+	return
+}
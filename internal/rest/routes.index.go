@@ -5,3 +5,8 @@ import "github.com/gofiber/fiber/v2"
 func (s *Server) routeIndex(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusTeapot).SendString("Hello World 🐧!")
 }
+
+// routeNotFound handles all requests which didn't match any route
+func (s *Server) routeNotFound(ctx *fiber.Ctx) error {
+	return fiber.NewError(fiber.StatusNotFound, "Cannot "+ctx.Method()+" "+ctx.OriginalURL())
+}
@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"github.com/ICBX/penguin/internal/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"strconv"
+	"time"
+)
+
+// metricsMiddleware observes the latency of every request by its matched route
+func (s *Server) metricsMiddleware(ctx *fiber.Ctx) error {
+	start := time.Now()
+	err := ctx.Next()
+
+	// errors are only written to the response after the middleware chain,
+	// so take the status code from the returned error if there is any
+	status := ctx.Response().StatusCode()
+	if err != nil {
+		status = errorStatus(err)
+	}
+
+	// label values are kept by the registry, so they must not reference the request buffer
+	metrics.HTTPRequestDuration.WithLabelValues(
+		utils.CopyString(ctx.Method()),
+		utils.CopyString(ctx.Route().Path),
+		strconv.Itoa(status),
+	).Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (s *Server) routeMetrics() fiber.Handler {
+	handler := fasthttpadaptor.NewFastHTTPHandler(
+		promhttp.HandlerFor(metrics.NewRegistry(s.db), promhttp.HandlerOpts{}),
+	)
+	return func(ctx *fiber.Ctx) error {
+		handler(ctx.Context())
+		return nil
+	}
+}
@@ -0,0 +1,17 @@
+package rest
+
+import (
+	_ "embed"
+	"github.com/gofiber/fiber/v2"
+)
+
+// openAPISpec describes all routes of the server, it's checked against the registered routes in the tests
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// GET /openapi.json
+func (s *Server) routeOpenAPI(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return ctx.Status(fiber.StatusOK).Send(openAPISpec)
+}
@@ -0,0 +1,33 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/internal/search"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+)
+
+// GET /search?q=penguin&limit=50&offset=0
+// searches current and previous titles, descriptions and tags of enabled videos
+func (s *Server) routeSearch(ctx *fiber.Ctx) (err error) {
+	limit, err := strconv.Atoi(ctx.Query("limit", "50"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid limit")
+	}
+	offset, err := strconv.Atoi(ctx.Query("offset", "0"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid offset")
+	}
+
+	res, err := search.Search(s.db, ctx.Query("q"), limit, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, search.ErrEmptyQuery):
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, search.ErrUnsupported):
+			return fiber.NewError(fiber.StatusNotImplemented, err.Error())
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
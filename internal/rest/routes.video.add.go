@@ -9,8 +9,11 @@ import (
 
 // rest payloads
 type newVideoPayload struct {
+	// VideoID is either a video id or a YouTube URL
 	VideoID  string `json:"videoID"`
 	Blobbers []uint `json:"blobbers"`
+	// Verify checks if the video exists on YouTube before adding it
+	Verify bool `json:"verify"`
 }
 
 func (s *Server) routeVideoAdd(ctx *fiber.Ctx) (err error) {
@@ -19,31 +22,55 @@ func (s *Server) routeVideoAdd(ctx *fiber.Ctx) (err error) {
 		return
 	}
 
-	video := &common.Video{ID: req.VideoID}
+	var videoID string
+	if videoID, err = common.ParseVideoID(req.VideoID); err != nil {
+		return &common.ValidationError{Fields: []*common.FieldError{{Field: "videoID", Message: err.Error()}}}
+	}
 
-	// check if video already in database
-	if err = s.db.Where(video).First(&common.Video{}).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	if req.Verify || ctx.Query("verify") == "yes" {
+		if err = s.verifyVideo(videoID); err != nil {
+			return
 		}
 	}
 
-	// add blobbers to video
-	for _, bid := range req.Blobbers {
-		var blobber common.BlobDownloader
-		if err = s.db.Where(&common.BlobDownloader{
-			ID: bid,
-		}).First(&blobber).Error; err != nil {
-			if !errors.Is(err, gorm.ErrRecordNotFound) {
-				return fiber.NewError(fiber.StatusInternalServerError, err.Error())
-			}
+	if err = s.db.Transaction(func(tx *gorm.DB) (err error) {
+		// check if video already in database (including disabled videos)
+		if err = tx.Unscoped().Where(&common.Video{ID: videoID}).First(&common.Video{}).Error; err == nil {
+			return &common.ConflictError{Message: "video already exists"}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return
 		}
-		video.Blobbers = append(video.Blobbers, &blobber)
-	}
 
-	if err = s.db.Create(video).Error; err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		// add blobbers to video
+		var blobbers []*common.BlobDownloader
+		if blobbers, err = findBlobbers(tx, req.Blobbers); err != nil {
+			return
+		}
+
+		return tx.Create(&common.Video{
+			ID:       videoID,
+			Blobbers: blobbers,
+		}).Error
+	}); err != nil {
+		return
 	}
 
+	audit(ctx, "video.add", auditTarget("video", videoID), nil, fiber.Map{"blobbers": req.Blobbers})
+	ctx.Location(MediaVideoPrefix + "/" + videoID)
 	return ctx.Status(fiber.StatusCreated).SendString("video created")
 }
+
+// verifyVideo checks if the video exists on YouTube
+func (s *Server) verifyVideo(videoID string) error {
+	if s.service == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "video verification not available")
+	}
+	resp, err := s.service.Videos.List([]string{"id"}).Id(videoID).Do()
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, "cannot verify video: "+err.Error())
+	}
+	if len(resp.Items) == 0 {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "video does not exist on YouTube")
+	}
+	return nil
+}
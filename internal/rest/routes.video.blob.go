@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+const (
+	// blobberHealthyTimeout is the time since the last heartbeat or pull after which a blobber isn't used to serve blobs
+	blobberHealthyTimeout = 5 * time.Minute
+	// blobURLExpiry is the validity of signed blob URLs
+	blobURLExpiry = time.Hour
+)
+
+type blobURLResponse struct {
+	BlobberID uint      `json:"blobberID"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// VerifiedAt is the time of the last successful verification of the copy
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+}
+
+// GET /media/video/:video_id/blob?type=video&redirect=no
+// redirects to a signed URL of the blob on a healthy blobber,
+// with redirect=no the signed URLs of all healthy blobbers are returned instead
+func (s *Server) routeVideoBlob(ctx *fiber.Ctx) (err error) {
+	videoID := utils.CopyString(ctx.Params(VideoIDKey))
+	typ, ok := parseBlobType(ctx.Query("type", common.VideoBlobType.String()))
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid type (video/thumbnail/caption)")
+	}
+
+	if err = s.db.Where(&common.Video{ID: videoID}).First(&common.Video{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &common.NotFoundError{Resource: "video", ID: videoID}
+		}
+		return
+	}
+
+	var locations []*common.BlobLocation
+	if err = s.db.Preload("BlobDownloader").
+		Where(&common.BlobLocation{VideoID: videoID, Type: typ}).
+		Find(&locations).Error; err != nil {
+		return
+	}
+	if len(locations) == 0 {
+		return &common.NotFoundError{Resource: typ.String() + " blob of video", ID: videoID}
+	}
+
+	now := time.Now()
+	urls := s.blobURLs(locations, now)
+	if len(urls) == 0 {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "no healthy blobber serves the blob")
+	}
+
+	if ctx.Query("redirect") == "no" {
+		return ctx.Status(fiber.StatusOK).JSON(urls)
+	}
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.Redirect(urls[0].URL, fiber.StatusFound)
+}
+
+// blobURLs returns the signed URLs of the locations on healthy blobbers with a public URL,
+// verified copies and recently seen blobbers come first
+func (s *Server) blobURLs(locations []*common.BlobLocation, now time.Time) (urls []blobURLResponse) {
+	seen := make(map[uint]bool)
+	var healthy []*common.BlobLocation
+	for _, l := range locations {
+		b := l.BlobDownloader
+		if b == nil || seen[b.ID] || b.PublicURL == "" ||
+			!b.LastSeen.Valid || now.Sub(b.LastSeen.Time) > blobberHealthyTimeout {
+			continue
+		}
+		seen[b.ID] = true
+		healthy = append(healthy, l)
+	}
+	sort.SliceStable(healthy, func(i, j int) bool {
+		a, b := healthy[i], healthy[j]
+		if a.VerifiedAt.Valid != b.VerifiedAt.Valid {
+			return a.VerifiedAt.Valid
+		}
+		return a.BlobDownloader.LastSeen.Time.After(b.BlobDownloader.LastSeen.Time)
+	})
+
+	expires := now.Add(blobURLExpiry)
+	urls = make([]blobURLResponse, len(healthy))
+	for i, l := range healthy {
+		path := common.BlobPath(l.VideoID, l.Type)
+		urls[i] = blobURLResponse{
+			BlobberID: l.BlobDownloaderID,
+			URL:       l.BlobDownloader.PublicURL + path + "?" + common.SignBlobQuery(l.BlobDownloader.Secret, path, expires).Encode(),
+			ExpiresAt: expires.Truncate(time.Second),
+		}
+		if l.VerifiedAt.Valid {
+			urls[i].VerifiedAt = &l.VerifiedAt.Time
+		}
+	}
+	return
+}
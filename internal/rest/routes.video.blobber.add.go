@@ -2,12 +2,13 @@ package rest
 
 import (
 	"errors"
+	"github.com/ICBX/penguin/internal/tasks"
 	"github.com/ICBX/penguin/pkg/common"
 	"github.com/apex/log"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/utils"
 	"gorm.io/gorm"
-	"net/http"
+	"strconv"
 )
 
 // rest payloads
@@ -21,47 +22,51 @@ func (s *Server) routeVideoAddBlobber(ctx *fiber.Ctx) (err error) {
 		return
 	}
 
-	videoId := utils.CopyString(ctx.Params(VideoIDKey))
-	if videoId == "" {
-		return fiber.NewError(http.StatusBadRequest, "videoID missing")
-	}
+	videoID := utils.CopyString(ctx.Params(VideoIDKey))
 
-	// get video
-	var video *common.Video
-	if err = s.db.Where(&common.Video{
-		ID: videoId,
-	}).First(&video).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fiber.NewError(fiber.StatusNotFound, "Video doesn't exists")
+	var (
+		video   common.Video
+		blobber common.BlobDownloader
+	)
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		// get video
+		if err = tx.Where(&common.Video{ID: videoID}).First(&video).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &common.NotFoundError{Resource: "video", ID: videoID}
+			}
+			return
 		}
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
-	}
 
-	// get blobber
-	var blobber common.BlobDownloader
-	if err = s.db.Where(&common.BlobDownloader{
-		ID: req.BlobberID,
-	}).First(&blobber).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return fiber.NewError(fiber.StatusNotFound, "blobber doesn't exists")
+		// get blobber
+		if err = tx.Where(&common.BlobDownloader{ID: req.BlobberID}).First(&blobber).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &common.NotFoundError{Resource: "blobber", ID: strconv.FormatUint(uint64(req.BlobberID), 10)}
+			}
+			return
 		}
-		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
-	}
 
-	// add initial download queue entry for video and blobber
-	if err = s.db.Create(&common.Queue{
-		VideoID:   videoId,
-		BlobberID: req.BlobberID,
-		Action:    common.GetBlob,
-	}).Error; err != nil {
-		return fiber.NewError(fiber.StatusConflict, err.Error())
-	}
+		// add initial download queue entry for video and blobber
+		var created bool
+		if created, err = tasks.Enqueue(tx, &common.Queue{
+			VideoID:   videoID,
+			BlobberID: req.BlobberID,
+			Action:    common.GetBlob,
+			Type:      common.VideoBlobType,
+		}); err != nil {
+			return
+		}
+		if !created {
+			return &common.ConflictError{Message: "video already queued for blobber"}
+		}
 
-	// add blobber to video
-	video.Blobbers = append(video.Blobbers, &blobber)
-	s.db.Updates(video)
+		// add blobber to video
+		return tx.Model(&video).Omit("Blobbers.*").Association("Blobbers").Append(&blobber)
+	}); err != nil {
+		return
+	}
 
-	log.Infof("Added blobber '%n' (%s) for video '%s' (%s)", blobber.Name, blobber.ID, video.Title, video.ID)
+	log.Infof("Added blobber '%s' (%d) for video '%s' (%s)", blobber.Name, blobber.ID, video.Title, video.ID)
+	audit(ctx, "video.blobber_add", auditTarget("video", videoID), nil, fiber.Map{"blobberID": blobber.ID})
 
 	return ctx.Status(fiber.StatusCreated).SendString("blobber added for video")
 }
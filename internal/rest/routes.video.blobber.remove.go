@@ -2,6 +2,7 @@ package rest
 
 import (
 	"errors"
+	"github.com/ICBX/penguin/internal/tasks"
 	"github.com/ICBX/penguin/pkg/common"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/utils"
@@ -19,54 +20,81 @@ func (s *Server) routeVideoRemoveBlobber(ctx *fiber.Ctx) (err error) {
 		return fiber.NewError(fiber.StatusBadRequest, "Could not process blobber id")
 	}
 
-	// find corresponding video
-	// and check if it exists
-	var video common.Video
-	if err = s.db.Where(&common.Video{ID: videoID}).First(&video).Error; err != nil {
-		return fiber.NewError(fiber.StatusNotFound, "Did not find video")
-	}
+	if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+		// find corresponding video
+		// and check if it exists
+		var video common.Video
+		if err = tx.Where(&common.Video{ID: videoID}).First(&video).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &common.NotFoundError{Resource: "video", ID: videoID}
+			}
+			return
+		}
 
-	// find corresponding blobber
-	// and check if it exists
-	var blobber common.BlobDownloader
-	if err = s.db.Where(common.BlobDownloader{ID: blobberIDU}).First(&blobber).Error; err != nil {
-		return fiber.NewError(fiber.StatusNotFound, "Did not find blobber")
-	}
+		// find corresponding blobber
+		// and check if it exists
+		var blobber common.BlobDownloader
+		if err = tx.Where(common.BlobDownloader{ID: blobberIDU}).First(&blobber).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &common.NotFoundError{Resource: "blobber", ID: blobberID}
+			}
+			return
+		}
 
-	// remove blobber from all corresponding videos
-	if err = s.db.Model(&video).Association("Blobbers").Delete(&blobber); err != nil {
-		return fiber.NewError(fiber.StatusInternalServerError, "Could not remove blobber from video: "+err.Error())
-	}
+		// remove blobber from all corresponding videos
+		if err = tx.Model(&video).Association("Blobbers").Delete(&blobber); err != nil {
+			return
+		}
 
-	// remove BlobLocation for blobberID and videoID
-	if err = s.db.Where(&common.BlobLocation{
-		VideoID:          videoID,
-		BlobDownloaderID: blobberIDU,
-	}).Delete(&common.BlobLocation{}).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		// collect stored blob types, the video itself is always removed
+		types := []common.BlobType{common.VideoBlobType}
+		var stored []common.BlobType
+		if err = tx.Model(&common.BlobLocation{}).Where(&common.BlobLocation{
+			VideoID:          videoID,
+			BlobDownloaderID: blobberIDU,
+		}).Distinct().Pluck("type", &stored).Error; err != nil {
+			return
+		}
+		for _, typ := range stored {
+			if typ != common.VideoBlobType {
+				types = append(types, typ)
+			}
 		}
-	}
 
-	// remove queue entry if exists
-	if err = s.db.Where(&common.Queue{
-		VideoID:   videoID,
-		BlobberID: blobberIDU,
-		Action:    common.GetBlob,
-	}).Delete(&common.Queue{}).Error; err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+		// remove BlobLocation for blobberID and videoID
+		if err = tx.Where(&common.BlobLocation{
+			VideoID:          videoID,
+			BlobDownloaderID: blobberIDU,
+		}).Delete(&common.BlobLocation{}).Error; err != nil {
+			return
 		}
-	}
 
-	// add video to blobber 'remove' queue
-	if err = s.db.Create(&common.Queue{
-		VideoID:   videoID,
-		BlobberID: blobberIDU,
-		Action:    common.RemoveBlob,
-	}).Error; err != nil {
-		return fiber.NewError(fiber.StatusConflict, err.Error())
+		// remove queued downloads and verifications
+		if err = tx.Where("video_id = ? AND blobber_id = ? AND action <> ?", videoID, blobberIDU, common.RemoveBlob).
+			Delete(&common.Queue{}).Error; err != nil {
+			return
+		}
+
+		// add blobs to blobber 'remove' queue
+		for _, typ := range types {
+			var created bool
+			if created, err = tasks.Enqueue(tx, &common.Queue{
+				VideoID:   videoID,
+				BlobberID: blobberIDU,
+				Action:    common.RemoveBlob,
+				Type:      typ,
+			}); err != nil {
+				return
+			}
+			if !created && typ == common.VideoBlobType {
+				return &common.ConflictError{Message: "video already queued for removal"}
+			}
+		}
+		return
+	}); err != nil {
+		return
 	}
 
+	audit(ctx, "video.blobber_remove", auditTarget("video", videoID), fiber.Map{"blobberID": blobberIDU}, nil)
 	return ctx.Status(fiber.StatusCreated).SendString("blobber removed from video")
 }
@@ -0,0 +1,346 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// rest payloads
+type bulkVideoPayload struct {
+	Videos   []string `json:"videos"`
+	Blobbers []uint   `json:"blobbers"`
+}
+
+const (
+	BulkItemCreated = "created"
+	BulkItemExists  = "exists"
+	BulkItemInvalid = "invalid"
+	BulkItemError   = "error"
+)
+
+type bulkVideoItem struct {
+	Input   string `json:"input"`
+	VideoID string `json:"videoID,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	// Assigned contains the blobbers which were assigned to an existing video
+	Assigned []uint `json:"assigned,omitempty"`
+}
+
+type bulkVideoResponse struct {
+	Created int             `json:"created"`
+	Exists  int             `json:"exists"`
+	Failed  int             `json:"failed"`
+	Items   []bulkVideoItem `json:"items"`
+}
+
+// POST /media/video/bulk?blobbers=1,2&verify=yes
+// adds many videos at once. The body is either
+//   - JSON: {"videos": ["<id or url>", ...], "blobbers": [1, 2]} or ["<id or url>", ...]
+//   - CSV: the first column contains ids or urls, a header row is skipped
+//   - plain text: one id or url per line
+//
+// Blobbers from the query are assigned to all videos in addition to the ones in the JSON body.
+// If verify is set, videos which don't exist on YouTube are reported as invalid.
+func (s *Server) routeVideoBulkAdd(ctx *fiber.Ctx) (err error) {
+	var req bulkVideoPayload
+	if req.Blobbers, err = parseUintList(ctx.Query("blobbers")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid blobbers")
+	}
+
+	body := ctx.Body()
+	switch contentType := strings.ToLower(ctx.Get(fiber.HeaderContentType)); {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		err = parseBulkJSON(body, &req)
+	case strings.HasPrefix(contentType, "text/csv"):
+		err = parseBulkCSV(body, &req)
+	default:
+		err = parseBulkLines(body, &req)
+	}
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if len(req.Videos) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "no videos given")
+	}
+
+	blobbers, err := findBlobbers(s.db, req.Blobbers)
+	if err != nil {
+		return
+	}
+
+	verify := ctx.Query("verify") == "yes"
+	if verify && s.service == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "video verification not available")
+	}
+
+	res := bulkVideoResponse{Items: make([]bulkVideoItem, len(req.Videos))}
+	created := []string{}
+	seen := make(map[string]bool)
+	for i, input := range req.Videos {
+		item := bulkVideoItem{Input: input}
+
+		if item.VideoID, err = common.ParseVideoID(input); err != nil {
+			item.Status, item.Error = BulkItemInvalid, err.Error()
+		} else if seen[item.VideoID] {
+			item.Status = BulkItemExists
+		} else {
+			seen[item.VideoID] = true
+			item.Status, item.Assigned, err = s.bulkAddVideo(item.VideoID, blobbers, verify)
+			if err != nil {
+				item.Error = err.Error()
+			}
+		}
+
+		switch item.Status {
+		case BulkItemCreated:
+			res.Created++
+			created = append(created, item.VideoID)
+		case BulkItemExists:
+			res.Exists++
+		default:
+			res.Failed++
+		}
+		res.Items[i] = item
+	}
+
+	audit(ctx, "video.bulk_add", "", nil, fiber.Map{"videos": created, "blobbers": req.Blobbers})
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
+
+// bulkAddVideo creates the video if it doesn't exist yet (including disabled videos),
+// existing videos are assigned the blobbers they don't have yet
+func (s *Server) bulkAddVideo(videoID string, blobbers []*common.BlobDownloader, verify bool) (status string, assigned []uint, err error) {
+	v := new(common.Video)
+	if err = s.db.Unscoped().Preload("Blobbers").Where(&common.Video{ID: videoID}).First(v).Error; err == nil {
+		if assigned, err = s.assignMissingBlobbers(v, blobbers); err != nil {
+			return BulkItemError, assigned, err
+		}
+		return BulkItemExists, assigned, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return BulkItemError, nil, err
+	}
+
+	if verify {
+		if err = s.verifyVideo(videoID); err != nil {
+			var ferr *fiber.Error
+			if errors.As(err, &ferr) && ferr.Code == fiber.StatusUnprocessableEntity {
+				return BulkItemInvalid, nil, err
+			}
+			return BulkItemError, nil, err
+		}
+	}
+
+	if err = s.db.Create(&common.Video{
+		ID:       videoID,
+		Blobbers: blobbers,
+	}).Error; err != nil {
+		return BulkItemError, nil, err
+	}
+	return BulkItemCreated, nil, nil
+}
+
+// assignMissingBlobbers assigns the blobbers which aren't assigned to the video yet and queues their downloads
+func (s *Server) assignMissingBlobbers(v *common.Video, blobbers []*common.BlobDownloader) (assigned []uint, err error) {
+	has := make(map[uint]bool)
+	for _, b := range v.Blobbers {
+		has[b.ID] = true
+	}
+	for _, b := range blobbers {
+		if has[b.ID] {
+			continue
+		}
+		if err = tasks.Transaction(s.db, func(tx *gorm.DB) (err error) {
+			_, err = tasks.AssignBlobber(tx, v, b)
+			return
+		}); err != nil {
+			return
+		}
+		has[b.ID] = true
+		assigned = append(assigned, b.ID)
+	}
+	return
+}
+
+// findBlobbers returns the blobbers with the given ids
+func findBlobbers(db *gorm.DB, ids []uint) (blobbers []*common.BlobDownloader, err error) {
+	var verr common.ValidationError
+	for _, id := range ids {
+		var blobber common.BlobDownloader
+		if err = db.Where(&common.BlobDownloader{ID: id}).First(&blobber).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return
+			}
+			verr.Add("blobbers", fmt.Sprintf("blobber %d doesn't exist", id))
+			continue
+		}
+		blobbers = append(blobbers, &blobber)
+	}
+	return blobbers, verr.Err()
+}
+
+func parseBulkJSON(body []byte, req *bulkVideoPayload) error {
+	// plain list of videos
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		return json.Unmarshal(trimmed, &req.Videos)
+	}
+	var payload bulkVideoPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return err
+	}
+	req.Videos = payload.Videos
+	req.Blobbers = append(req.Blobbers, payload.Blobbers...)
+	return nil
+}
+
+func parseBulkCSV(body []byte, req *bulkVideoPayload) error {
+	r := csv.NewReader(bytes.NewReader(body))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) == 0 || record[0] == "" {
+			continue
+		}
+		// skip header
+		if first {
+			switch strings.ToLower(record[0]) {
+			case "id", "videoid", "video_id", "url":
+				continue
+			}
+		}
+		req.Videos = append(req.Videos, record[0])
+	}
+}
+
+func parseBulkLines(body []byte, req *bulkVideoPayload) error {
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			req.Videos = append(req.Videos, line)
+		}
+	}
+	return sc.Err()
+}
+
+// parseUintList parses a comma separated list of unsigned integers
+func parseUintList(s string) (res []uint, err error) {
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		var u uint
+		if u, err = convertStringToUint(part); err != nil {
+			return
+		}
+		res = append(res, u)
+	}
+	return
+}
+
+var exportCSVHeader = []string{
+	"id", "channelID", "title", "description", "tags", "videoLength",
+	"viewCount", "likeCount", "commentCount", "rating", "privacy", "availability", "broadcast",
+	"publishedAt", "lastUpdated",
+}
+
+// GET /media/video/export?format=csv|ndjson
+// streams all enabled videos with their meta data.
+// If the export fails midway the last line contains the error, {"error": "..."} or a "#error" CSV record.
+func (s *Server) routeVideoExport(ctx *fiber.Ctx) (err error) {
+	format := ctx.Query("format", "ndjson")
+	switch format {
+	case "csv":
+		ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	case "ndjson":
+		ctx.Set(fiber.HeaderContentType, "application/x-ndjson")
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "invalid format (csv/ndjson)")
+	}
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="videos.`+format+`"`)
+
+	db := s.db
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var (
+			cw  = csv.NewWriter(w)
+			enc = json.NewEncoder(w)
+		)
+		if format == "csv" {
+			_ = cw.Write(exportCSVHeader)
+		}
+
+		var batch []*common.Video
+		if err := db.Order("id").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, v := range batch {
+				if format == "csv" {
+					if err := cw.Write(exportCSVRecord(v)); err != nil {
+						return err
+					}
+				} else if err := enc.Encode(v); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return w.Flush()
+		}).Error; err != nil {
+			// the status was already sent, mark the export as incomplete
+			log.WithError(err).Warn("Video export failed")
+			if format == "csv" {
+				_ = cw.Write([]string{"#error", err.Error()})
+				cw.Flush()
+			} else {
+				_ = enc.Encode(fiber.Map{"error": err.Error()})
+			}
+			_ = w.Flush()
+		}
+	})
+	return
+}
+
+func exportCSVRecord(v *common.Video) []string {
+	var publishedAt, lastUpdated string
+	if v.PublishedAt.Valid {
+		publishedAt = v.PublishedAt.Time.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	if v.LastUpdated.Valid {
+		lastUpdated = v.LastUpdated.Time.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return []string{
+		v.ID,
+		v.ChannelID,
+		v.Title,
+		v.Description,
+		v.Tags,
+		v.VideoLength,
+		strconv.FormatUint(v.ViewCount, 10),
+		strconv.FormatUint(v.LikeCount, 10),
+		strconv.FormatUint(v.CommentCount, 10),
+		strconv.Itoa(int(v.Rating)),
+		v.PrivacyStatus.String(),
+		v.Availability.String(),
+		v.BroadcastState.String(),
+		publishedAt,
+		lastUpdated,
+	}
+}
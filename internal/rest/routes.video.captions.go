@@ -0,0 +1,19 @@
+package rest
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// GET /media/video/:video_id/captions
+// returns all known caption tracks of the video including deleted tracks
+func (s *Server) routeVideoCaptions(ctx *fiber.Ctx) (err error) {
+	var captions []*common.Caption
+	if err = s.db.Where(&common.Caption{
+		VideoID: utils.CopyString(ctx.Params(VideoIDKey)),
+	}).Order("language").Find(&captions).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(captions)
+}
@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// rest payloads
+type videoCommentsPayload struct {
+	Enabled bool `json:"enabled"`
+}
+
+// PUT /media/video/:video_id/comments
+// enables or disables comment archiving for the video
+func (s *Server) routeVideoCommentsToggle(ctx *fiber.Ctx) (err error) {
+	var req videoCommentsPayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+
+	v, err := s.findRouteVideo(ctx)
+	if err != nil {
+		return
+	}
+	before := v.ArchiveComments
+	if err = s.db.Model(v).Update("archive_comments", req.Enabled).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	audit(ctx, "video.comments", auditTarget("video", v.ID),
+		fiber.Map{"archiveComments": before}, fiber.Map{"archiveComments": req.Enabled})
+
+	if req.Enabled {
+		return ctx.Status(fiber.StatusOK).SendString("comment archiving enabled")
+	}
+	return ctx.Status(fiber.StatusOK).SendString("comment archiving disabled")
+}
+
+// GET /media/video/:video_id/comments
+// returns all archived comment threads of the video including deleted comments
+func (s *Server) routeVideoComments(ctx *fiber.Ctx) (err error) {
+	videoID := utils.CopyString(ctx.Params(VideoIDKey))
+
+	if err = s.db.Where(&common.Video{ID: videoID}).First(&common.Video{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "video not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	var threads []*common.CommentThread
+	if err = s.db.Where(&common.CommentThread{VideoID: videoID}).
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("published_at")
+		}).
+		Find(&threads).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(threads)
+}
+
+// GET /media/video/:video_id/comments/:comment_id/history
+// returns the edit history of a comment
+func (s *Server) routeCommentHistory(ctx *fiber.Ctx) (err error) {
+	videoID := utils.CopyString(ctx.Params(VideoIDKey))
+	commentID := utils.CopyString(ctx.Params(CommentIDKey))
+
+	if err = s.db.Where(&common.Video{ID: videoID}).First(&common.Video{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "video not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	if err = s.db.Where(&common.Comment{ID: commentID, VideoID: videoID}).First(&common.Comment{}).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "comment not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	var history []*common.CommentHistory
+	if err = s.db.Joins("JOIN comments ON comments.id = comment_histories.comment_id").
+		Where("comment_histories.comment_id = ? AND comments.video_id = ?", commentID, videoID).
+		Order("comment_histories.updated_at").
+		Find(&history).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(history)
+}
@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"errors"
+	"github.com/ICBX/penguin/internal/tasks"
 	"github.com/ICBX/penguin/pkg/common"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/utils"
@@ -14,6 +16,9 @@ import (
 // ---
 // Enable Video:
 // DELETE /media/videos/:id?state=enable
+// ---
+// Disabled videos are neither refreshed nor handed out for download until they are enabled again.
+// Permanently deleted videos (perm=yes) are removed from all blobbers and all of their data is deleted.
 func (s *Server) routeVideoDisable(ctx *fiber.Ctx) (err error) {
 	state := ctx.Query("state", "disable")
 	perm := ctx.Query("perm", "no")
@@ -21,14 +26,22 @@ func (s *Server) routeVideoDisable(ctx *fiber.Ctx) (err error) {
 	where := &common.Video{
 		ID: utils.CopyString(ctx.Params(VideoIDKey)),
 	}
+	target := auditTarget("video", where.ID)
+	before := s.auditVideoState(where.ID)
 
 	var tx *gorm.DB
 	if state == "disable" {
-		if perm != "yes" {
-			tx = s.db.Delete(where)
-		} else {
-			tx = s.db.Unscoped().Delete(where)
+		if perm == "yes" {
+			if _, err = tasks.PurgeVideo(s.db, where.ID); err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fiber.NewError(fiber.StatusNotFound, "video not found")
+				}
+				return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+			}
+			audit(ctx, "video.purge", target, before, nil)
+			return ctx.Status(201).SendString("video deleted")
 		}
+		tx = s.db.Delete(where)
 	} else if state == "enable" {
 		tx = s.db.Unscoped().Model(where).Where(where).Update("deleted_at", gorm.Expr("NULL"))
 	} else {
@@ -41,5 +54,19 @@ func (s *Server) routeVideoDisable(ctx *fiber.Ctx) (err error) {
 	if tx.RowsAffected <= 0 {
 		return fiber.NewError(fiber.StatusNotFound, "video not found or already in requested state")
 	}
+	audit(ctx, "video."+state, target, before, s.auditVideoState(where.ID))
 	return ctx.Status(201).SendString("video " + state + "d") // <- that's illegal! refactor later.
 }
+
+// auditVideoState returns the state of the video (including disabled videos) for the audit log
+func (s *Server) auditVideoState(videoID string) fiber.Map {
+	var v common.Video
+	if err := s.db.Unscoped().Where(&common.Video{ID: videoID}).First(&v).Error; err != nil {
+		return nil
+	}
+	return fiber.Map{
+		"title":     v.Title,
+		"channelID": v.ChannelID,
+		"disabled":  v.DeletedAt.Valid,
+	}
+}
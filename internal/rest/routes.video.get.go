@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+// GET /media/video?broadcast=upcoming&collection=1&limit=100&offset=0
+// lists all enabled videos, optionally filtered by their broadcast state and collection
+func (s *Server) routeVideoList(ctx *fiber.Ctx) (err error) {
+	limit, err := strconv.Atoi(ctx.Query("limit", "100"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid limit")
+	}
+	offset, err := strconv.Atoi(ctx.Query("offset", "0"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid offset")
+	}
+
+	tx := s.db.Model(&common.Video{})
+	if b := ctx.Query("broadcast"); b != "" {
+		state, ok := common.BroadcastStateByName[b]
+		if !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid broadcast state (none/upcoming/live/completed)")
+		}
+		tx = tx.Where(&common.Video{BroadcastState: state})
+	}
+
+	if c := ctx.Query("collection"); c != "" {
+		var id uint
+		if id, err = convertStringToUint(c); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid collection")
+		}
+		tx = tx.Where("id IN (?)", s.db.Table("collection_videos").
+			Select("video_id").
+			Where("collection_id = ?", id))
+	}
+
+	var videos []*common.Video
+	if err = tx.Order("id").Limit(limit).Offset(offset).Find(&videos).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(videos)
+}
+
+// videoResponse is a video including its queued jobs
+type videoResponse struct {
+	*common.Video
+	Queue []queueItemResponse `json:"queue"`
+}
+
+// GET /media/video/:video_id
+func (s *Server) routeVideo(ctx *fiber.Ctx) (err error) {
+	var video common.Video
+	if err = s.db.Preload("Blobbers").Where(&common.Video{
+		ID: utils.CopyString(ctx.Params(VideoIDKey)),
+	}).First(&video).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "video not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	var queue []*common.Queue
+	if err = s.db.Where(&common.Queue{VideoID: video.ID}).Order("blobber_id, action, type").Find(&queue).Error; err != nil {
+		return
+	}
+	res := videoResponse{Video: &video, Queue: make([]queueItemResponse, len(queue))}
+	for i, q := range queue {
+		res.Queue[i] = newQueueItemResponse(q)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
@@ -0,0 +1,59 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+	"time"
+)
+
+type snapshotResponse struct {
+	Hash string    `json:"hash"`
+	Time time.Time `json:"time"`
+}
+
+// GET /media/video/:video_id/snapshot?at=2022-04-01T00:00:00Z
+// returns the raw YouTube Data API response of the video at the given time (default: now)
+func (s *Server) routeVideoSnapshot(ctx *fiber.Ctx) (err error) {
+	videoID := utils.CopyString(ctx.Params(VideoIDKey))
+
+	at := time.Now()
+	if q := ctx.Query("at"); q != "" {
+		if at, err = time.Parse(time.RFC3339, q); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid time, expected RFC3339")
+		}
+	}
+
+	snapshot, data, err := tasks.SnapshotAt(s.db, videoID, at)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "no snapshot found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	ctx.Set("X-Snapshot-Hash", snapshot.Hash)
+	ctx.Set("X-Snapshot-Time", snapshot.Time.Format(time.RFC3339))
+	ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return ctx.Status(fiber.StatusOK).Send(data)
+}
+
+// GET /media/video/:video_id/snapshots
+// lists all snapshots of the video
+func (s *Server) routeVideoSnapshots(ctx *fiber.Ctx) (err error) {
+	videoID := utils.CopyString(ctx.Params(VideoIDKey))
+
+	var snapshots []*common.VideoSnapshot
+	if err = s.db.Where(&common.VideoSnapshot{VideoID: videoID}).Order("time").Find(&snapshots).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]snapshotResponse, len(snapshots))
+	for i, snapshot := range snapshots {
+		res[i] = snapshotResponse{Hash: snapshot.Hash, Time: snapshot.Time}
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
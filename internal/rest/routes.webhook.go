@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rest payloads
+type newWebhookPayload struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type webhookResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newWebhookResponse(hook *common.Webhook) webhookResponse {
+	evs := []string{}
+	if hook.Events != "" {
+		evs = strings.Split(hook.Events, ",")
+	}
+	return webhookResponse{
+		ID:        hook.ID,
+		URL:       hook.URL,
+		Events:    evs,
+		Active:    hook.Active,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+// auditWebhookState returns the state of the webhook for the audit log, the secret is left out
+func auditWebhookState(hook *common.Webhook) fiber.Map {
+	return fiber.Map{"url": hook.URL, "events": hook.Events, "active": hook.Active}
+}
+
+func (s *Server) routeWebhookAdd(ctx *fiber.Ctx) (err error) {
+	var req newWebhookPayload
+	if err = ctx.BodyParser(&req); err != nil {
+		return
+	}
+
+	var verr common.ValidationError
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.Add("url", "valid http(s) url required")
+	}
+	if req.Secret == "" {
+		verr.Add("secret", "required")
+	}
+	evs := make([]string, len(req.Events))
+	for i, e := range req.Events {
+		evs[i] = strings.TrimSpace(e)
+		if evs[i] != "*" && !events.Known(events.Type(evs[i])) {
+			verr.Add("events", "unknown event type '"+evs[i]+"'")
+		}
+	}
+	if err = verr.Err(); err != nil {
+		return
+	}
+
+	hook := &common.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: strings.Join(evs, ","),
+		Active: true,
+	}
+	if err = s.db.Create(hook).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	audit(ctx, "webhook.add", auditTarget("webhook", hook.ID), nil, auditWebhookState(hook))
+	return ctx.Status(fiber.StatusCreated).JSON(newWebhookResponse(hook))
+}
+
+func (s *Server) routeWebhookList(ctx *fiber.Ctx) (err error) {
+	var hooks []*common.Webhook
+	if err = s.db.Find(&hooks).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	res := make([]webhookResponse, len(hooks))
+	for i, hook := range hooks {
+		res[i] = newWebhookResponse(hook)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(res)
+}
+
+func (s *Server) routeWebhookDelete(ctx *fiber.Ctx) (err error) {
+	var id uint
+	if id, err = convertStringToUint(utils.CopyString(ctx.Params(WebhookIDKey))); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Could not process webhook id")
+	}
+
+	hook := new(common.Webhook)
+	if err = s.db.Transaction(func(tx *gorm.DB) (err error) {
+		if err = tx.First(hook, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &common.NotFoundError{Resource: "webhook", ID: strconv.FormatUint(uint64(id), 10)}
+			}
+			return
+		}
+		// delete delivery log as well
+		if err = tx.Where(&common.WebhookDelivery{WebhookID: id}).Delete(&common.WebhookDelivery{}).Error; err != nil {
+			return
+		}
+		return tx.Delete(hook).Error
+	}); err != nil {
+		return
+	}
+
+	audit(ctx, "webhook.delete", auditTarget("webhook", id), auditWebhookState(hook), nil)
+	return ctx.Status(fiber.StatusOK).SendString("webhook deleted")
+}
+
+func (s *Server) routeWebhookDeliveries(ctx *fiber.Ctx) (err error) {
+	var id uint
+	if id, err = convertStringToUint(utils.CopyString(ctx.Params(WebhookIDKey))); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Could not process webhook id")
+	}
+
+	if err = s.db.First(&common.Webhook{}, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "webhook not found")
+		}
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+
+	limit, err := strconv.Atoi(ctx.Query("limit", "100"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid limit")
+	}
+
+	var deliveries []*common.WebhookDelivery
+	if err = s.db.Where(&common.WebhookDelivery{WebhookID: id}).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, err.Error())
+	}
+	return ctx.Status(fiber.StatusOK).JSON(deliveries)
+}
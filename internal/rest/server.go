@@ -1,18 +1,85 @@
 package rest
 
 import (
+	"encoding/json"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/internal/tasks"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/websocket/v2"
+	"google.golang.org/api/youtube/v3"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Server struct {
 	db  *gorm.DB
 	app *fiber.App
+
+	// status of the meta updater, used for readiness checks
+	status *tasks.Status
+	// readyThreshold is the maximum age of the last meta update for the service to be ready
+	readyThreshold time.Duration
+
+	// bus is the source of the event stream
+	bus *events.Bus
+	// done is closed on shutdown to end open event streams
+	done chan struct{}
+
+	// service is used to verify videos before adding them
+	service *youtube.Service
+
+	// limits are applied by limiters
+	limits   RateLimits
+	limiters *limiters
+}
+
+// Option configures optional dependencies of the Server
+type Option func(s *Server)
+
+// WithUpdaterStatus sets the status of the meta updater which is reported by the readiness endpoint
+func WithUpdaterStatus(status *tasks.Status) Option {
+	return func(s *Server) {
+		s.status = status
+	}
+}
+
+// WithEventBus sets the bus which is streamed by the events endpoint
+func WithEventBus(bus *events.Bus) Option {
+	return func(s *Server) {
+		s.bus = bus
+	}
+}
+
+// WithReadyThreshold sets the maximum age of the last meta update for the service to be ready
+func WithReadyThreshold(threshold time.Duration) Option {
+	return func(s *Server) {
+		s.readyThreshold = threshold
+	}
+}
+
+// WithRateLimits replaces the DefaultRateLimits
+func WithRateLimits(limits RateLimits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithYouTube sets the YouTube service which is used to verify videos before adding them
+func WithYouTube(service *youtube.Service) Option {
+	return func(s *Server) {
+		s.service = service
+	}
 }
 
 const (
 	VideoIDKey   = "video_id"
 	BlobberIDKey = "blobber_id"
+	WebhookIDKey = "webhook_id"
+	CommentIDKey = "comment_id"
+	ChannelIDKey = "channel_id"
+
+	CollectionIDKey = "collection_id"
 )
 
 const (
@@ -20,39 +87,163 @@ const (
 	MediaVideoPrefix    = MediaPrefix + "/video"
 	SpecificVideoPrefix = MediaVideoPrefix + "/:" + VideoIDKey
 
+	MediaChannelPrefix    = MediaPrefix + "/channel"
+	SpecificChannelPrefix = MediaChannelPrefix + "/:" + ChannelIDKey
+
 	BlobberPrefix         = "/blobber"
 	SpecificBlobberPrefix = BlobberPrefix + "/:" + BlobberIDKey
+
+	CollectionPrefix         = "/collection"
+	SpecificCollectionPrefix = CollectionPrefix + "/:" + CollectionIDKey
+
+	WebhookPrefix         = "/webhook"
+	SpecificWebhookPrefix = WebhookPrefix + "/:" + WebhookIDKey
 )
 
 // routes
 const (
 	RouteAddVideo               = MediaVideoPrefix                            // POST
+	RouteListVideos             = MediaVideoPrefix                            // GET
+	RouteGetVideo               = SpecificVideoPrefix                         // GET
+	RouteBulkAddVideos          = MediaVideoPrefix + "/bulk"                  // POST
+	RouteExportVideos           = MediaVideoPrefix + "/export"                // GET
 	RouteDeleteVideo            = SpecificVideoPrefix                         // DELETE
 	RouteAddBlobberToVideo      = SpecificVideoPrefix + SpecificBlobberPrefix // POST
 	RouteRemoveBlobberFromVideo = SpecificVideoPrefix + SpecificBlobberPrefix // DELETE
+	RouteVideoSnapshot          = SpecificVideoPrefix + "/snapshot"           // GET
+	RouteVideoSnapshots         = SpecificVideoPrefix + "/snapshots"          // GET
+	RouteVideoComments          = SpecificVideoPrefix + "/comments"           // GET, PUT
+	RouteVideoCaptions          = SpecificVideoPrefix + "/captions"           // GET
+	RouteVideoBlob              = SpecificVideoPrefix + "/blob"               // GET
+
+	RouteCommentHistory = RouteVideoComments + "/:" + CommentIDKey + "/history" // GET
+
+	RouteChannel        = SpecificChannelPrefix              // GET
+	RouteChannelHistory = SpecificChannelPrefix + "/history" // GET
+
+	RouteAddBlobber       = BlobberPrefix         // POST
+	RouteListBlobbers     = BlobberPrefix         // GET
+	RouteUpdateBlobber    = SpecificBlobberPrefix // PUT
+	RouteBlobberPull      = SpecificBlobberPrefix + "/pull"
+	RouteBlobberReport    = SpecificBlobberPrefix + "/report"    // POST
+	RouteBlobberHeartbeat = SpecificBlobberPrefix + "/heartbeat" // POST
+	RouteBlobberSocket    = SpecificBlobberPrefix + "/socket"    // GET (websocket)
+	RouteBlobberProgress  = SpecificBlobberPrefix + "/progress"  // POST
 
-	RouteAddBlobber  = BlobberPrefix
-	RouteBlobberPull = SpecificBlobberPrefix + "/pull"
+	RouteListQueue = "/queue" // GET
+
+	RouteAddCollection               = CollectionPrefix                                   // POST
+	RouteListCollections             = CollectionPrefix                                   // GET
+	RouteGetCollection               = SpecificCollectionPrefix                           // GET
+	RouteUpdateCollection            = SpecificCollectionPrefix                           // PUT
+	RouteDeleteCollection            = SpecificCollectionPrefix                           // DELETE
+	RouteAddVideoToCollection        = SpecificCollectionPrefix + "/video/:" + VideoIDKey // POST
+	RouteRemoveVideoFromCollection   = SpecificCollectionPrefix + "/video/:" + VideoIDKey // DELETE
+	RouteAddBlobberToCollection      = SpecificCollectionPrefix + SpecificBlobberPrefix   // POST
+	RouteRemoveBlobberFromCollection = SpecificCollectionPrefix + SpecificBlobberPrefix   // DELETE
+
+	RouteAddWebhook        = WebhookPrefix                       // POST
+	RouteListWebhooks      = WebhookPrefix                       // GET
+	RouteDeleteWebhook     = SpecificWebhookPrefix               // DELETE
+	RouteWebhookDeliveries = SpecificWebhookPrefix + "/delivery" // GET
+
+	RouteListAudit = "/audit" // GET
+
+	RouteMetrics = "/metrics"
+	RouteHealth  = "/healthz"
+	RouteReady   = "/readyz"
+	RouteEvents  = "/events"
+	RouteSearch  = "/search"
+
+	RouteOpenAPI = "/openapi.json"
 )
 
-func New(db *gorm.DB) (s *Server) {
-	app := fiber.New(fiber.Config{})
+const DefaultReadyThreshold = 5 * time.Minute
+
+func New(db *gorm.DB, opts ...Option) (s *Server) {
 	s = &Server{
-		db:  db,
-		app: app,
+		db:             db,
+		readyThreshold: DefaultReadyThreshold,
+		bus:            events.Default,
+		done:           make(chan struct{}),
+		limits:         DefaultRateLimits,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	s.limiters = newLimiters(s.limits)
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: s.errorHandler,
+		// encoding/json reports typed errors for malformed bodies
+		// and handles the recursive models embedded in responses
+		JSONEncoder: json.Marshal,
+		JSONDecoder: json.Unmarshal,
+	})
+	s.app = app
+
+	app.Use(requestid.New())
+	app.Use(s.metricsMiddleware)
+	app.Use(s.rateLimitMiddleware)
+	app.Use(s.auditMiddleware)
 
 	// TODO: Add routes below 👇
 	app.Get("/", s.routeIndex)
+	app.Get(RouteMetrics, s.routeMetrics()) // prometheus metrics
+	app.Get(RouteHealth, s.routeHealth)     // liveness probe
+	app.Get(RouteReady, s.routeReady)       // readiness probe
+	app.Get(RouteEvents, s.routeEvents)     // server-sent events
+	app.Get(RouteSearch, s.routeSearch)     // full-text search
+	app.Get(RouteOpenAPI, s.routeOpenAPI)   // OpenAPI specification
 	// video
 	app.Post(RouteAddVideo, s.routeVideoAdd)                           // add video
+	app.Get(RouteListVideos, s.routeVideoList)                         // list videos
+	app.Post(RouteBulkAddVideos, s.routeVideoBulkAdd)                  // bulk add videos
+	app.Get(RouteExportVideos, s.routeVideoExport)                     // export videos (before :video_id)
+	app.Get(RouteGetVideo, s.routeVideo)                               // get video
 	app.Delete(RouteDeleteVideo, s.routeVideoDisable)                  // remove video
 	app.Post(RouteAddBlobberToVideo, s.routeVideoAddBlobber)           // add blobber to video
 	app.Delete(RouteRemoveBlobberFromVideo, s.routeVideoRemoveBlobber) // remove blobber from video
+	app.Get(RouteVideoSnapshot, s.routeVideoSnapshot)                  // get snapshot at time
+	app.Get(RouteVideoSnapshots, s.routeVideoSnapshots)                // list snapshots
+	app.Get(RouteVideoComments, s.routeVideoComments)                  // list comments
+	app.Put(RouteVideoComments, s.routeVideoCommentsToggle)            // toggle comment archiving
+	app.Get(RouteCommentHistory, s.routeCommentHistory)                // comment edit history
+	app.Get(RouteVideoCaptions, s.routeVideoCaptions)                  // list caption tracks
+	app.Get(RouteVideoBlob, s.routeVideoBlob)                          // redirect to a stored blob
+	// channel
+	app.Get(RouteChannel, s.routeChannel)               // get channel
+	app.Get(RouteChannelHistory, s.routeChannelHistory) // channel change history
 	// blobber
-	app.Post(RouteAddBlobber, s.routeBlobberAdd)  // add blobber
-	app.Get(RouteBlobberPull, s.routeBlobberPull) // pull blobber queue
+	app.Post(RouteAddBlobber, s.routeBlobberAdd)             // add blobber
+	app.Get(RouteListBlobbers, s.routeBlobberList)           // list blobbers with capacity
+	app.Put(RouteUpdateBlobber, s.routeBlobberUpdate)        // update blobber limits
+	app.Get(RouteBlobberPull, s.routeBlobberPull)            // pull blobber queue
+	app.Post(RouteBlobberReport, s.routeBlobberReport)       // report finished job
+	app.Post(RouteBlobberHeartbeat, s.routeBlobberHeartbeat) // blobber heartbeat
+	app.Get(RouteBlobberSocket, s.routeBlobberSocketUpgrade,
+		websocket.New(s.routeBlobberSocket)) // push jobs to blobber
+	app.Post(RouteBlobberProgress, s.routeBlobberProgress) // report job progress
+	app.Get(RouteListQueue, s.routeQueueList)              // list queued jobs
+	// collection
+	app.Post(RouteAddCollection, s.routeCollectionAdd)                           // add collection
+	app.Get(RouteListCollections, s.routeCollectionList)                         // list collections
+	app.Get(RouteGetCollection, s.routeCollection)                               // get collection
+	app.Put(RouteUpdateCollection, s.routeCollectionUpdate)                      // update collection
+	app.Delete(RouteDeleteCollection, s.routeCollectionDelete)                   // remove collection
+	app.Post(RouteAddVideoToCollection, s.routeCollectionAddVideo)               // add video to collection
+	app.Delete(RouteRemoveVideoFromCollection, s.routeCollectionRemoveVideo)     // remove video from collection
+	app.Post(RouteAddBlobberToCollection, s.routeCollectionAddBlobber)           // assign blobber to collection
+	app.Delete(RouteRemoveBlobberFromCollection, s.routeCollectionRemoveBlobber) // remove blobber from collection
+	// webhook
+	app.Post(RouteAddWebhook, s.routeWebhookAdd)              // add webhook
+	app.Get(RouteListWebhooks, s.routeWebhookList)            // list webhooks
+	app.Delete(RouteDeleteWebhook, s.routeWebhookDelete)      // remove webhook
+	app.Get(RouteWebhookDeliveries, s.routeWebhookDeliveries) // webhook delivery log
+	// audit
+	app.Get(RouteListAudit, s.routeAuditList) // list audit log
 	// TODO: Add routes above 👆
+	app.Use(s.routeNotFound)
 
 	return
 }
@@ -62,5 +253,6 @@ func (s *Server) Listen(addr string) error {
 }
 
 func (s *Server) Shutdown() error {
+	close(s.done)
 	return s.app.Shutdown()
 }
@@ -1,21 +1,38 @@
 package rest
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/internal/search"
+	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/pkg/client"
 	"github.com/ICBX/penguin/pkg/common"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
+// testVideoID is a valid YouTube video id
+const testVideoID = "dQw4w9WgXcQ"
+
 type TestSuite struct {
 	db *gorm.DB
 	s  *Server
@@ -39,6 +56,27 @@ func TestTestSuite(t *testing.T) {
 	})
 }
 
+// SetupTest resets the database before every test
+func (suite *TestSuite) SetupTest() {
+	tables := append([]interface{}{"videos_blob_downloader", "collection_videos", "collection_blobbers", "search_index"}, common.TableModels...)
+	if err := suite.db.Migrator().DropTable(tables...); err != nil {
+		suite.T().Fatal(err)
+	}
+	if err := suite.db.AutoMigrate(common.TableModels...); err != nil {
+		suite.T().Fatal(err)
+	}
+	if err := search.Migrate(suite.db); err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.setLimits(DefaultRateLimits)
+}
+
+// setLimits replaces the rate limits of the server and resets all limiters
+func (suite *TestSuite) setLimits(limits RateLimits) {
+	suite.s.limits = limits
+	suite.s.limiters = newLimiters(limits)
+}
+
 func (suite *TestSuite) TestURL() {
 	assert.Equal(suite.T(), "/hello/world", suite.url("/:a/:b", "a", "hello", "b", "world"))
 	assert.Equal(suite.T(), "/media/video/hello", suite.url(RouteDeleteVideo, VideoIDKey, "hello"))
@@ -51,36 +89,36 @@ func (suite *TestSuite) TestVideoCycle() {
 	assert.Equal(suite.T(), 0, len(suite.utilFindVideos()))
 
 	// create video
-	res = suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: "hello"})
+	res = suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: testVideoID})
 	suite.assert(res, fiber.StatusCreated)
 	assert.Equal(suite.T(), 1, len(suite.utilFindVideos()))
 
 	/// disable video
-	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, "hello"))
+	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, testVideoID))
 	suite.assert(res, fiber.StatusCreated)
 	assert.Equal(suite.T(), 0, len(suite.utilFindVideos()))
 
 	/// re-enable video
-	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, "hello")+"?state=enable")
+	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, testVideoID)+"?state=enable")
 	suite.assert(res, fiber.StatusCreated)
 	assert.Equal(suite.T(), 1, len(suite.utilFindVideos()))
 
 	/// completely disable video
-	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, "hello")+"?perm=yes")
+	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, testVideoID)+"?perm=yes")
 	suite.assert(res, fiber.StatusCreated)
 	assert.Equal(suite.T(), 0, len(suite.utilFindVideos()))
 
 	/// re-enable video
-	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, "hello")+"?state=enable")
+	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, testVideoID)+"?state=enable")
 	suite.assert(res, fiber.StatusNotFound)
 	assert.Equal(suite.T(), 0, len(suite.utilFindVideos()))
 
 	/// invalid state
-	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, "hello")+"?state=braun")
+	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, testVideoID)+"?state=braun")
 	suite.assert(res, fiber.StatusBadRequest)
 
 	// create video
-	res = suite.jsonReq("POST", suite.url(RouteAddVideo, VideoIDKey, "hello"), newVideoPayload{VideoID: "hello"})
+	res = suite.jsonReq("POST", suite.url(RouteAddVideo, VideoIDKey, testVideoID), newVideoPayload{VideoID: testVideoID})
 	suite.assert(res, fiber.StatusCreated)
 	assert.Equal(suite.T(), 1, len(suite.utilFindVideos()))
 
@@ -88,7 +126,10 @@ func (suite *TestSuite) TestVideoCycle() {
 	// assert that none exist yet
 	assert.Equal(suite.T(), 0, len(suite.utilFindBlobber()))
 
-	// TODO: assert that missing secret and name throws error
+	// missing name and secret
+	res = suite.jsonReq("POST", suite.url(RouteAddBlobber), newBlobberPayload{})
+	suite.assert(res, fiber.StatusBadRequest)
+	assert.Equal(suite.T(), 0, len(suite.utilFindBlobber()))
 
 	// create blobber
 	res = suite.jsonReq("POST", suite.url(RouteAddBlobber), newBlobberPayload{Name: "blobby", Secret: "blobby"})
@@ -96,16 +137,1322 @@ func (suite *TestSuite) TestVideoCycle() {
 	assert.Equal(suite.T(), 1, len(suite.utilFindBlobber()))
 
 	/// add blobber to video
-	res = suite.jsonReq("POST", suite.url(RouteAddBlobberToVideo, VideoIDKey, "hello"), newVideoBlobberPayload{BlobberID: 1})
+	res = suite.jsonReq("POST", suite.url(RouteAddBlobberToVideo, VideoIDKey, testVideoID), newVideoBlobberPayload{BlobberID: 1})
 	suite.assert(res, fiber.StatusCreated)
 	assert.Equal(suite.T(), 1, len(suite.utilFindQueue()))
+	suite.db.Create(&common.Queue{VideoID: testVideoID, BlobberID: 1, Action: common.VerifyBlob, Type: common.VideoBlobType})
 
 	/// remove blobber from video
 	res = suite.req("DELETE", "/media/videos/hello/blobber/1")
-	res = suite.req("DELETE", suite.url(RouteRemoveBlobberFromVideo, VideoIDKey, "hello", BlobberIDKey, "1"))
+	res = suite.req("DELETE", suite.url(RouteRemoveBlobberFromVideo, VideoIDKey, testVideoID, BlobberIDKey, "1"))
 	suite.assert(res, fiber.StatusCreated)
-	assert.Equal(suite.T(), 1, len(suite.utilFindQueue()))
+	// only the removal is left
+	if queue := suite.utilFindQueue(); assert.Len(suite.T(), queue, 1) {
+		assert.Equal(suite.T(), common.RemoveBlob, queue[0].Action)
+	}
+
+}
+
+func (suite *TestSuite) TestVideoPurge() {
+	suite.utilCreateBlobber("blobby", "secret")
+	res := suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: testVideoID, Blobbers: []uint{1}})
+	suite.assert(res, fiber.StatusCreated)
+	suite.db.Create(&common.BlobLocation{VideoID: testVideoID, BlobDownloaderID: 1, Path: "a.mp4", AddedAt: time.Now(), Type: common.VideoBlobType})
+	suite.db.Create(&common.VideoHistory{VideoID: testVideoID, Field: "title", UpdatedAt: time.Now()})
+
+	res = suite.req("DELETE", suite.url(RouteDeleteVideo, VideoIDKey, testVideoID)+"?perm=yes")
+	suite.assert(res, fiber.StatusCreated)
+
+	if queue := suite.utilFindQueue(); assert.Len(suite.T(), queue, 1) {
+		assert.Equal(suite.T(), common.RemoveBlob, queue[0].Action)
+	}
+	var n int64
+	suite.db.Model(&common.VideoHistory{}).Count(&n)
+	assert.Equal(suite.T(), int64(0), n)
+	suite.db.Model(&common.BlobLocation{}).Count(&n)
+	assert.Equal(suite.T(), int64(0), n)
+
+	// removals are still handed out
+	res = suite.reqAdv("GET", suite.url(RouteBlobberPull, BlobberIDKey, "1"), http.Header{
+		"Blobber-Secret": []string{"secret"},
+	}, nil)
+	suite.assert(res, fiber.StatusOK)
+	var pull BlobberPullResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&pull))
+	assert.Equal(suite.T(), []string{testVideoID}, pull.Remove)
+}
+
+func (suite *TestSuite) TestBlobberReport() {
+	suite.utilCreateBlobber("blobby", "secret")
+	res := suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: testVideoID, Blobbers: []uint{1}})
+	suite.assert(res, fiber.StatusCreated)
+	suite.db.Create(&common.Queue{VideoID: testVideoID, BlobberID: 1, Action: common.GetBlob})
+
+	route := suite.url(RouteBlobberReport, BlobberIDKey, "1")
+	report := BlobberReportPayload{VideoID: testVideoID, Action: common.GetBlob, Path: "hello.mp4"}
+
+	// wrong secret
+	res = suite.blobberReq("POST", route, "wrong", report)
+	suite.assert(res, fiber.StatusUnauthorized)
+
+	evs, cancel := events.Subscribe(2)
+	defer cancel()
+
+	res = suite.blobberReq("POST", route, "secret", report)
+	suite.assert(res, fiber.StatusCreated)
+	assert.Equal(suite.T(), 0, len(suite.utilFindQueue()))
+
+	var locations []*common.BlobLocation
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	if assert.Len(suite.T(), locations, 1) {
+		assert.Equal(suite.T(), "hello.mp4", locations[0].Path)
+		assert.Equal(suite.T(), common.VideoBlobType, locations[0].Type)
+	}
+	assert.Equal(suite.T(), events.QueueCompleted, (<-evs).Type)
+	assert.Equal(suite.T(), events.VideoArchived, (<-evs).Type)
+
+	// repeated reports replace the location
+	report.Path, report.Size = "again.mp4", 100
+	res = suite.blobberReq("POST", route, "secret", report)
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	if assert.Len(suite.T(), locations, 1) {
+		assert.Equal(suite.T(), "again.mp4", locations[0].Path)
+		assert.Equal(suite.T(), int64(100), locations[0].Size)
+	}
+
+	// remove blob
+	res = suite.blobberReq("POST", route, "secret", BlobberReportPayload{VideoID: testVideoID, Action: common.RemoveBlob})
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	assert.Len(suite.T(), locations, 0)
+}
+
+func (suite *TestSuite) TestBlobberVerify() {
+	suite.utilCreateBlobber("blobby", "secret")
+	suite.db.Create(&common.Video{ID: testVideoID})
+	suite.db.Create(&common.BlobLocation{VideoID: testVideoID, BlobDownloaderID: 1, Path: "a.mp4",
+		AddedAt: time.Now(), Type: common.VideoBlobType, Checksum: "abc"})
+	suite.db.Create(&common.Queue{VideoID: testVideoID, BlobberID: 1, Action: common.VerifyBlob, Type: common.VideoBlobType})
+
+	route := suite.url(RouteBlobberReport, BlobberIDKey, "1")
+
+	// checksum or missing is required
+	res := suite.blobberReq("POST", route, "secret", BlobberReportPayload{VideoID: testVideoID, Action: common.VerifyBlob})
+	suite.assert(res, fiber.StatusBadRequest)
+
+	res = suite.blobberReq("POST", route, "secret",
+		BlobberReportPayload{VideoID: testVideoID, Action: common.VerifyBlob, Checksum: "abc"})
+	suite.assert(res, fiber.StatusCreated)
+	assert.Len(suite.T(), suite.utilFindQueue(), 0)
+
+	var locations []*common.BlobLocation
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	if assert.Len(suite.T(), locations, 1) {
+		assert.True(suite.T(), locations[0].VerifiedAt.Valid)
+	}
+
+	evs, cancel := events.Subscribe(8)
+	defer cancel()
+
+	// corrupt blobs are downloaded again
+	suite.db.Create(&common.Queue{VideoID: testVideoID, BlobberID: 1, Action: common.VerifyBlob, Type: common.VideoBlobType})
+	res = suite.blobberReq("POST", route, "secret",
+		BlobberReportPayload{VideoID: testVideoID, Action: common.VerifyBlob, Checksum: "def"})
+	suite.assert(res, fiber.StatusCreated)
+
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	assert.Len(suite.T(), locations, 0)
+	queue := suite.utilFindQueue()
+	if assert.Len(suite.T(), queue, 1) {
+		assert.Equal(suite.T(), common.GetBlob, queue[0].Action)
+	}
+
+	var types []events.Type
+	for len(evs) > 0 {
+		e := <-evs
+		types = append(types, e.Type)
+		if e.Type == events.BlobDamaged {
+			assert.Equal(suite.T(), "corrupt", e.Data.(events.BlobVerification).Status)
+		}
+	}
+	assert.Contains(suite.T(), types, events.BlobDamaged)
+	assert.Contains(suite.T(), types, events.QueueEnqueued)
+
+	// the new download records the checksum
+	res = suite.blobberReq("POST", route, "secret",
+		BlobberReportPayload{VideoID: testVideoID, Action: common.GetBlob, Path: "a.mp4", Checksum: "def"})
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	if assert.Len(suite.T(), locations, 1) {
+		assert.Equal(suite.T(), "def", locations[0].Checksum)
+		assert.True(suite.T(), locations[0].VerifiedAt.Valid)
+	}
+
+	// missing blobs are downloaded again as well
+	suite.db.Create(&common.Queue{VideoID: testVideoID, BlobberID: 1, Action: common.VerifyBlob, Type: common.VideoBlobType})
+	res = suite.blobberReq("POST", route, "secret",
+		BlobberReportPayload{VideoID: testVideoID, Action: common.VerifyBlob, Missing: true})
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), suite.db.Find(&locations).Error)
+	assert.Len(suite.T(), locations, 0)
+}
+
+func (suite *TestSuite) TestVideoBlob() {
+	now := time.Now()
+	suite.db.Create(&common.Video{ID: testVideoID})
+	suite.db.Create([]*common.BlobDownloader{
+		{Name: "healthy", Secret: "s1", PublicURL: "https://one.example", LastSeen: sql.NullTime{Valid: true, Time: now}},
+		{Name: "stale", Secret: "s2", PublicURL: "https://two.example", LastSeen: sql.NullTime{Valid: true, Time: now.Add(-time.Hour)}},
+		{Name: "private", Secret: "s3", LastSeen: sql.NullTime{Valid: true, Time: now}},
+		{Name: "verified", Secret: "s4", PublicURL: "https://four.example", LastSeen: sql.NullTime{Valid: true, Time: now.Add(-time.Minute)}},
+	})
+	for _, id := range []uint{1, 2, 3, 4} {
+		suite.db.Create(&common.BlobLocation{VideoID: testVideoID, BlobDownloaderID: id, Path: "a.mp4", AddedAt: now,
+			Type: common.VideoBlobType, VerifiedAt: sql.NullTime{Valid: id == 4, Time: now}})
+	}
+	route := suite.url(RouteVideoBlob, VideoIDKey, testVideoID)
+
+	res := suite.req("GET", route+"?type=audio")
+	suite.assert(res, fiber.StatusBadRequest)
+	res = suite.req("GET", suite.url(RouteVideoBlob, VideoIDKey, "unknown"))
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.req("GET", route+"?type=caption")
+	suite.assert(res, fiber.StatusNotFound)
+
+	// verified copies are preferred
+	res = suite.req("GET", route)
+	suite.assert(res, fiber.StatusFound)
+	loc, err := url.Parse(res.Header.Get(fiber.HeaderLocation))
+	if assert.NoError(suite.T(), err) {
+		assert.Equal(suite.T(), "four.example", loc.Host)
+		assert.Equal(suite.T(), common.BlobPath(testVideoID, common.VideoBlobType), loc.Path)
+		assert.NoError(suite.T(), common.VerifyBlobQuery("s4", loc.Path, loc.Query(), now))
+	}
+
+	// stale blobbers and blobbers without public url aren't used
+	res = suite.req("GET", route+"?redirect=no")
+	suite.assert(res, fiber.StatusOK)
+	var urls []blobURLResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&urls))
+	if assert.Len(suite.T(), urls, 2) {
+		assert.Equal(suite.T(), uint(4), urls[0].BlobberID)
+		assert.NotNil(suite.T(), urls[0].VerifiedAt)
+		assert.Equal(suite.T(), uint(1), urls[1].BlobberID)
+		assert.True(suite.T(), strings.HasPrefix(urls[1].URL, "https://one.example/blob/"))
+	}
+
+	suite.db.Model(&common.BlobDownloader{}).Where("id IN ?", []uint{1, 4}).Update("public_url", "")
+	res = suite.req("GET", route)
+	suite.assert(res, fiber.StatusServiceUnavailable)
+
+	// public urls are validated
+	res = suite.jsonReq("PUT", suite.url(RouteUpdateBlobber, BlobberIDKey, "1"), blobberUpdatePayload{PublicURL: "one.example"})
+	suite.assert(res, fiber.StatusBadRequest)
+	res = suite.jsonReq("PUT", suite.url(RouteUpdateBlobber, BlobberIDKey, "1"), blobberUpdatePayload{PublicURL: "https://one.example/"})
+	suite.assert(res, fiber.StatusOK)
+	res = suite.req("GET", route)
+	suite.assert(res, fiber.StatusFound)
+	assert.True(suite.T(), strings.HasPrefix(res.Header.Get(fiber.HeaderLocation), "https://one.example/blob/"))
+}
+
+func (suite *TestSuite) TestBlobberPull() {
+	suite.utilCreateBlobber("blobby", "secret")
+	suite.db.Create(&common.Video{ID: "a"})
+	suite.db.Create(&common.Video{ID: "c", DeletedAt: gorm.DeletedAt{Valid: true, Time: time.Now()}})
+	suite.db.Create(&common.Queue{VideoID: "a", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType})
+	suite.db.Create(&common.Queue{VideoID: "a", BlobberID: 1, Action: common.GetBlob, Type: common.CaptionBlobType})
+	suite.db.Create(&common.Queue{VideoID: "b", BlobberID: 1, Action: common.RemoveBlob, Type: common.VideoBlobType})
+	// downloads of disabled videos are paused
+	suite.db.Create(&common.Queue{VideoID: "c", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType})
+
+	res := suite.reqAdv("GET", suite.url(RouteBlobberPull, BlobberIDKey, "1"), http.Header{
+		"Blobber-Secret": []string{"secret"},
+	}, nil)
+	suite.assert(res, fiber.StatusOK)
+
+	var pull BlobberPullResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&pull))
+	assert.Equal(suite.T(), []string{"a"}, pull.Download)
+	assert.Equal(suite.T(), []string{"b"}, pull.Remove)
+	assert.Len(suite.T(), pull.Jobs, 3)
+	assert.Contains(suite.T(), pull.Jobs, BlobberJob{VideoID: "a", Action: common.GetBlob, Type: common.CaptionBlobType})
+}
+
+func (suite *TestSuite) TestChannel() {
+	res := suite.req("GET", suite.url(RouteChannel, ChannelIDKey, "UC1"))
+	suite.assert(res, fiber.StatusNotFound)
+
+	suite.db.Create(&common.Channel{ID: "UC1", Title: "Penguins"})
+	suite.db.Create(&common.ChannelHistory{ChannelID: "UC1", Field: "title", Old: "Birds", New: "Penguins", UpdatedAt: time.Now()})
+
+	var channel common.Channel
+	res = suite.req("GET", suite.url(RouteChannel, ChannelIDKey, "UC1"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&channel))
+	assert.Equal(suite.T(), "Penguins", channel.Title)
+
+	var history []*common.ChannelHistory
+	res = suite.req("GET", suite.url(RouteChannelHistory, ChannelIDKey, "UC1"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&history))
+	assert.Len(suite.T(), history, 1)
+}
+
+func (suite *TestSuite) TestCollection() {
+	suite.utilCreateBlobber("a", "secret")
+	suite.db.Create(&common.Video{ID: "a"})
+	suite.db.Create(&common.Video{ID: "b"})
+	suite.db.Create(&common.Video{ID: "c"})
+
+	var c collectionResponse
+	res := suite.jsonReq("POST", RouteAddCollection, collectionPayload{Name: "Penguins"})
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&c))
+	res = suite.jsonReq("POST", RouteAddCollection, collectionPayload{Name: "Penguins"})
+	suite.assert(res, fiber.StatusConflict)
+	res = suite.jsonReq("POST", RouteAddCollection, collectionPayload{Name: " "})
+	suite.assert(res, fiber.StatusBadRequest)
+
+	id := strconv.Itoa(int(c.ID))
+	var assign collectionAssignResponse
+	res = suite.req("POST", suite.url(RouteAddVideoToCollection, CollectionIDKey, id, VideoIDKey, "a"))
+	suite.assert(res, fiber.StatusCreated)
+	res = suite.req("POST", suite.url(RouteAddVideoToCollection, CollectionIDKey, id, VideoIDKey, "a"))
+	suite.assert(res, fiber.StatusConflict)
+	res = suite.req("POST", suite.url(RouteAddVideoToCollection, CollectionIDKey, id, VideoIDKey, "d"))
+	suite.assert(res, fiber.StatusNotFound)
+
+	// blobbers of the collection are assigned to existing and new videos
+	res = suite.req("POST", suite.url(RouteAddBlobberToCollection, CollectionIDKey, id, BlobberIDKey, "1"))
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&assign))
+	assert.Equal(suite.T(), 1, assign.Queued)
+	res = suite.req("POST", suite.url(RouteAddBlobberToCollection, CollectionIDKey, id, BlobberIDKey, "1"))
+	suite.assert(res, fiber.StatusConflict)
+	res = suite.req("POST", suite.url(RouteAddVideoToCollection, CollectionIDKey, id, VideoIDKey, "b"))
+	suite.assert(res, fiber.StatusCreated)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&assign))
+	assert.Equal(suite.T(), 1, assign.Queued)
+	assert.Len(suite.T(), suite.utilFindQueue(), 2)
+
+	var video common.Video
+	assert.NoError(suite.T(), suite.db.Preload("Blobbers").First(&video, "id = ?", "b").Error)
+	assert.Len(suite.T(), video.Blobbers, 1)
+
+	res = suite.req("GET", suite.url(RouteGetCollection, CollectionIDKey, id))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&c))
+	assert.ElementsMatch(suite.T(), []string{"a", "b"}, c.Videos)
+	assert.Equal(suite.T(), []uint{1}, c.Blobbers)
+
+	var videos []*common.Video
+	res = suite.req("GET", RouteListVideos+"?collection="+id)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&videos))
+	assert.Len(suite.T(), videos, 2)
+
+	var collections []collectionResponse
+	res = suite.req("GET", RouteListCollections)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&collections))
+	if assert.Len(suite.T(), collections, 1) {
+		assert.Equal(suite.T(), int64(2), collections[0].VideoCount)
+	}
+
+	res = suite.jsonReq("PUT", suite.url(RouteUpdateCollection, CollectionIDKey, id), collectionPayload{Name: "Birds"})
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&c))
+	assert.Equal(suite.T(), "Birds", c.Name)
+
+	res = suite.req("DELETE", suite.url(RouteRemoveVideoFromCollection, CollectionIDKey, id, VideoIDKey, "b"))
+	suite.assert(res, fiber.StatusOK)
+	res = suite.req("DELETE", suite.url(RouteRemoveVideoFromCollection, CollectionIDKey, id, VideoIDKey, "b"))
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.req("GET", RouteListVideos+"?collection="+id)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&videos))
+	assert.Len(suite.T(), videos, 1)
+
+	res = suite.req("DELETE", suite.url(RouteRemoveBlobberFromCollection, CollectionIDKey, id, BlobberIDKey, "1"))
+	suite.assert(res, fiber.StatusOK)
+	res = suite.req("DELETE", suite.url(RouteRemoveBlobberFromCollection, CollectionIDKey, id, BlobberIDKey, "1"))
+	suite.assert(res, fiber.StatusNotFound)
+
+	res = suite.req("DELETE", suite.url(RouteDeleteCollection, CollectionIDKey, id))
+	suite.assert(res, fiber.StatusOK)
+	res = suite.req("GET", suite.url(RouteGetCollection, CollectionIDKey, id))
+	suite.assert(res, fiber.StatusNotFound)
+	assert.Len(suite.T(), suite.utilFindVideos(), 3)
+}
+
+func (suite *TestSuite) TestWebhookCycle() {
+	// invalid url
+	res := suite.jsonReq("POST", RouteAddWebhook, newWebhookPayload{URL: "ftp://example.com", Secret: "s"})
+	suite.assert(res, fiber.StatusBadRequest)
+	// unknown event type
+	res = suite.jsonReq("POST", RouteAddWebhook, newWebhookPayload{
+		URL:    "https://example.com/hook",
+		Secret: "s",
+		Events: []string{"video.renamed"},
+	})
+	suite.assert(res, fiber.StatusBadRequest)
+	var problem problemResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&problem))
+	if assert.Len(suite.T(), problem.Errors, 1) {
+		assert.Equal(suite.T(), "events", problem.Errors[0].Field)
+	}
+
+	res = suite.jsonReq("POST", RouteAddWebhook, newWebhookPayload{
+		URL:    "https://example.com/hook",
+		Secret: "s",
+		Events: []string{string(events.VideoPrivate)},
+	})
+	suite.assert(res, fiber.StatusCreated)
+
+	var hooks []webhookResponse
+	res = suite.req("GET", RouteListWebhooks)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&hooks))
+	if assert.Len(suite.T(), hooks, 1) {
+		assert.Equal(suite.T(), []string{string(events.VideoPrivate)}, hooks[0].Events)
+	}
+
+	res = suite.req("GET", suite.url(RouteWebhookDeliveries, WebhookIDKey, "1"))
+	suite.assert(res, fiber.StatusOK)
+
+	res = suite.req("DELETE", suite.url(RouteDeleteWebhook, WebhookIDKey, "1"))
+	suite.assert(res, fiber.StatusOK)
+	res = suite.req("DELETE", suite.url(RouteDeleteWebhook, WebhookIDKey, "1"))
+	suite.assert(res, fiber.StatusNotFound)
+}
+
+func (suite *TestSuite) TestEvents() {
+	bus := events.NewBus(events.DefaultHistorySize)
+	bus.Publish(events.Event{Type: events.QueueEnqueued, VideoID: "a"})
+	bus.Publish(events.Event{Type: events.VideoChanged, VideoID: "b"})
+	bus.Publish(events.Event{Type: events.QueueCompleted, VideoID: "c"})
+
+	base, shutdown := suite.listen(WithEventBus(bus))
+	defer shutdown()
+	route := base + RouteEvents + "?types=queue.enqueued,queue.completed"
+	id := func(n int) string {
+		return bus.Epoch() + "-" + strconv.Itoa(n)
+	}
+
+	r := suite.eventStream(route, id(0))
+	assert.True(suite.T(), strings.HasPrefix(suite.nextEvent(r), "id: "+id(1)+"\nevent: queue.enqueued\n"))
+	// filtered events are skipped
+	assert.True(suite.T(), strings.HasPrefix(suite.nextEvent(r), "id: "+id(3)+"\nevent: queue.completed\n"))
+
+	// live events follow the replay
+	bus.Publish(events.Event{Type: events.VideoChanged, VideoID: "d"})
+	bus.Publish(events.Event{Type: events.QueueEnqueued, VideoID: "e"})
+	assert.True(suite.T(), strings.HasPrefix(suite.nextEvent(r), "id: "+id(5)+"\nevent: queue.enqueued\n"))
+
+	// clients which missed events are told to refetch
+	r = suite.eventStream(route, id(42))
+	assert.True(suite.T(), strings.HasPrefix(suite.nextEvent(r), "event: stream.reset\n"))
+
+	// ids of an earlier run replay the complete history after the reset
+	for _, last := range []string{"42", "0-2"} {
+		r = suite.eventStream(route, last)
+		assert.True(suite.T(), strings.HasPrefix(suite.nextEvent(r), "event: stream.reset\n"))
+		assert.True(suite.T(), strings.HasPrefix(suite.nextEvent(r), "id: "+id(1)+"\n"))
+	}
+
+	r = suite.eventStream(route, "invalid")
+	assert.Nil(suite.T(), r)
+}
+
+func (suite *TestSuite) TestEventsSlowClient() {
+	bus := events.NewBus(0)
+	base, shutdown := suite.listen(WithEventBus(bus))
+	defer shutdown()
+	r := suite.eventStream(base+RouteEvents, "")
+	assert.Eventually(suite.T(), func() bool { return bus.Subscribers() == 1 }, time.Second, time.Millisecond)
+
+	// large events fill the socket and the buffer of the subscription while the client doesn't read
+	large := strings.Repeat("x", 64<<10)
+	for i := 0; i < 1000; i++ {
+		bus.Publish(events.Event{Type: events.QueueProgress, Data: large})
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				bus.Publish(events.Event{Type: events.QueueProgress})
+			}
+		}
+	}()
+
+	// the client is told about the missed events
+	for {
+		if strings.HasPrefix(suite.nextEvent(r), "event: stream.reset\n") {
+			return
+		}
+	}
+}
+
+func (suite *TestSuite) TestVideoGet() {
+	suite.db.Create(&common.Video{ID: "a", BroadcastState: common.NoneBroadcastState})
+	suite.db.Create(&common.Video{ID: "b", BroadcastState: common.UpcomingBroadcastState,
+		ScheduledStartTime: sql.NullTime{Valid: true, Time: time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)}})
+
+	var videos []*common.Video
+	res := suite.req("GET", RouteListVideos)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&videos))
+	assert.Len(suite.T(), videos, 2)
+
+	res = suite.req("GET", RouteListVideos+"?broadcast=upcoming")
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&videos))
+	if assert.Len(suite.T(), videos, 1) {
+		assert.Equal(suite.T(), "b", videos[0].ID)
+		assert.True(suite.T(), videos[0].ScheduledStartTime.Valid)
+	}
+
+	res = suite.req("GET", RouteListVideos+"?broadcast=soon")
+	suite.assert(res, fiber.StatusBadRequest)
+
+	var video common.Video
+	res = suite.req("GET", suite.url(RouteGetVideo, VideoIDKey, "b"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&video))
+	assert.Equal(suite.T(), common.UpcomingBroadcastState, video.BroadcastState)
+
+	// secrets of the blobbers are never returned
+	suite.db.Create(&common.Video{ID: "d", Blobbers: []*common.BlobDownloader{{Name: "blobby", Secret: "hunter2"}}})
+	res = suite.req("GET", suite.url(RouteGetVideo, VideoIDKey, "d"))
+	suite.assert(res, fiber.StatusOK)
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(suite.T(), err, "reading video")
+	assert.Contains(suite.T(), string(body), "blobby")
+	assert.NotContains(suite.T(), string(body), "hunter2")
+
+	res = suite.req("GET", suite.url(RouteGetVideo, VideoIDKey, "c"))
+	suite.assert(res, fiber.StatusNotFound)
+}
+
+func (suite *TestSuite) TestVideoAdd() {
+	for _, id := range []string{"", "hello", "https://example.com/watch?v=" + testVideoID} {
+		res := suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: id})
+		suite.assert(res, fiber.StatusBadRequest)
+	}
+	res := suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: testVideoID, Blobbers: []uint{1}})
+	suite.assert(res, fiber.StatusBadRequest)
+
+	res = suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: "https://youtu.be/" + testVideoID + "?t=42"})
+	suite.assert(res, fiber.StatusCreated)
+	assert.Equal(suite.T(), suite.url(RouteGetVideo, VideoIDKey, testVideoID), res.Header.Get(fiber.HeaderLocation))
+	if videos := suite.utilFindVideos(); assert.Len(suite.T(), videos, 1) {
+		assert.Equal(suite.T(), testVideoID, videos[0].ID)
+	}
+
+	res = suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: "https://www.youtube.com/shorts/" + testVideoID})
+	suite.assert(res, fiber.StatusConflict)
+
+	// verification is only available with a YouTube service
+	res = suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: "aaaaaaaaaaa", Verify: true})
+	suite.assert(res, fiber.StatusServiceUnavailable)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp youtube.VideoListResponse
+		if id := r.URL.Query().Get("id"); id == "aaaaaaaaaaa" {
+			resp.Items = []*youtube.Video{{Id: id}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(suite.T(), err)
+	s := New(suite.db, WithYouTube(service))
+
+	for id, status := range map[string]int{"aaaaaaaaaaa": fiber.StatusCreated, "bbbbbbbbbbb": fiber.StatusUnprocessableEntity} {
+		req := httptest.NewRequest("POST", RouteAddVideo+"?verify=yes", strings.NewReader(`{"videoID":"`+id+`"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		res, err = s.app.Test(req, -1)
+		assert.NoError(suite.T(), err)
+		suite.assert(res, status)
+	}
+}
+
+func (suite *TestSuite) TestVideoBulk() {
+	suite.utilCreateBlobber("a", "secret")
+	suite.db.Create(&common.Video{ID: "existing000"})
+
+	var report bulkVideoResponse
+	res := suite.jsonReq("POST", RouteBulkAddVideos, bulkVideoPayload{
+		Videos:   []string{"first000000", "https://youtu.be/second00000", "existing000", "first000000", "https://example.com/x"},
+		Blobbers: []uint{1},
+	})
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(suite.T(), 2, report.Created)
+	assert.Equal(suite.T(), 2, report.Exists)
+	assert.Equal(suite.T(), 1, report.Failed)
+	if assert.Len(suite.T(), report.Items, 5) {
+		assert.Equal(suite.T(), "second00000", report.Items[1].VideoID)
+		assert.Equal(suite.T(), BulkItemInvalid, report.Items[4].Status)
+		// existing videos get the missing blobbers
+		assert.Equal(suite.T(), BulkItemExists, report.Items[2].Status)
+		assert.Equal(suite.T(), []uint{1}, report.Items[2].Assigned)
+	}
+	if queue := suite.utilFindQueue(); assert.Len(suite.T(), queue, 1) {
+		assert.Equal(suite.T(), "existing000", queue[0].VideoID)
+	}
+
+	// csv with header, blobbers from query
+	res = suite.reqAdv("POST", RouteBulkAddVideos+"?blobbers=1", http.Header{
+		"Content-Type": []string{"text/csv"},
+	}, strings.NewReader("id,note\nthird000000,x\nfirst000000,y\n"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(suite.T(), 1, report.Created)
+	assert.Equal(suite.T(), 1, report.Exists)
+	assert.Empty(suite.T(), report.Items[1].Assigned)
+
+	// plain text
+	res = suite.reqAdv("POST", RouteBulkAddVideos, http.Header{
+		"Content-Type": []string{"text/plain"},
+	}, strings.NewReader("fourth00000\n\n# comment\n"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&report))
+	assert.Equal(suite.T(), 1, report.Created)
+
+	var video common.Video
+	assert.NoError(suite.T(), suite.db.Preload("Blobbers").First(&video, "id = ?", "third000000").Error)
+	assert.Len(suite.T(), video.Blobbers, 1)
+	assert.Len(suite.T(), suite.utilFindVideos(), 5)
+
+	// unknown blobber and empty body
+	res = suite.jsonReq("POST", RouteBulkAddVideos, bulkVideoPayload{Videos: []string{"fifth000000"}, Blobbers: []uint{2}})
+	suite.assert(res, fiber.StatusBadRequest)
+	res = suite.jsonReq("POST", RouteBulkAddVideos, bulkVideoPayload{})
+	suite.assert(res, fiber.StatusBadRequest)
+
+	// export
+	res = suite.req("GET", RouteExportVideos+"?format=csv")
+	suite.assert(res, fiber.StatusOK)
+	data, err := io.ReadAll(res.Body)
+	assert.NoError(suite.T(), err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(suite.T(), lines, 6) {
+		assert.True(suite.T(), strings.HasPrefix(lines[0], "id,channelID,title"))
+		assert.True(suite.T(), strings.HasPrefix(lines[1], "existing000,"))
+	}
+
+	res = suite.req("GET", RouteExportVideos)
+	suite.assert(res, fiber.StatusOK)
+	dec := json.NewDecoder(res.Body)
+	var count int
+	for dec.More() {
+		assert.NoError(suite.T(), dec.Decode(&video))
+		count++
+	}
+	assert.Equal(suite.T(), 5, count)
+
+	res = suite.req("GET", RouteExportVideos+"?format=xml")
+	suite.assert(res, fiber.StatusBadRequest)
+}
+
+func (suite *TestSuite) TestVideoSnapshot() {
+	t0 := time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC)
+	_, err := tasks.SaveSnapshot(suite.db, "hello", &youtube.Video{Id: "hello", Snippet: &youtube.VideoSnippet{Title: "a"}}, t0)
+	assert.NoError(suite.T(), err)
+	_, err = tasks.SaveSnapshot(suite.db, "hello", &youtube.Video{Id: "hello", Snippet: &youtube.VideoSnippet{Title: "b"}}, t0.Add(time.Hour))
+	assert.NoError(suite.T(), err)
 
+	var snapshots []snapshotResponse
+	res := suite.req("GET", suite.url(RouteVideoSnapshots, VideoIDKey, "hello"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&snapshots))
+	assert.Len(suite.T(), snapshots, 2)
+
+	var video youtube.Video
+	res = suite.req("GET", suite.url(RouteVideoSnapshot, VideoIDKey, "hello")+"?at=2022-04-01T00:30:00Z")
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&video))
+	assert.Equal(suite.T(), "a", video.Snippet.Title)
+
+	res = suite.req("GET", suite.url(RouteVideoSnapshot, VideoIDKey, "hello"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&video))
+	assert.Equal(suite.T(), "b", video.Snippet.Title)
+
+	res = suite.req("GET", suite.url(RouteVideoSnapshot, VideoIDKey, "hello")+"?at=2021-01-01T00:00:00Z")
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.req("GET", suite.url(RouteVideoSnapshot, VideoIDKey, "hello")+"?at=yesterday")
+	suite.assert(res, fiber.StatusBadRequest)
+}
+
+func (suite *TestSuite) TestVideoComments() {
+	route := suite.url(RouteVideoComments, VideoIDKey, testVideoID)
+
+	res := suite.jsonReq("PUT", route, videoCommentsPayload{Enabled: true})
+	suite.assert(res, fiber.StatusNotFound)
+
+	res = suite.jsonReq("POST", RouteAddVideo, newVideoPayload{VideoID: testVideoID})
+	suite.assert(res, fiber.StatusCreated)
+
+	res = suite.jsonReq("PUT", route, videoCommentsPayload{Enabled: true})
+	suite.assert(res, fiber.StatusOK)
+	var video common.Video
+	assert.NoError(suite.T(), suite.db.First(&video).Error)
+	assert.True(suite.T(), video.ArchiveComments)
+
+	now := time.Now()
+	suite.db.Create(&common.CommentThread{ID: "a", VideoID: testVideoID})
+	suite.db.Create(&common.Comment{ID: "a", ThreadID: "a", VideoID: testVideoID, Text: "hi", FirstSeen: now, LastSeen: now})
+	suite.db.Create(&common.CommentHistory{CommentID: "a", Old: "ho", New: "hi", UpdatedAt: now})
+
+	var threads []*common.CommentThread
+	res = suite.req("GET", route)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&threads))
+	if assert.Len(suite.T(), threads, 1) && assert.Len(suite.T(), threads[0].Comments, 1) {
+		assert.Equal(suite.T(), "hi", threads[0].Comments[0].Text)
+	}
+
+	var history []*common.CommentHistory
+	res = suite.req("GET", suite.url(RouteCommentHistory, VideoIDKey, testVideoID, CommentIDKey, "a"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&history))
+	assert.Len(suite.T(), history, 1)
+
+	// the comment has to belong to the video
+	suite.db.Create(&common.Video{ID: "other"})
+	res = suite.req("GET", suite.url(RouteCommentHistory, VideoIDKey, "other", CommentIDKey, "a"))
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.req("GET", suite.url(RouteCommentHistory, VideoIDKey, "missing", CommentIDKey, "a"))
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.req("GET", suite.url(RouteCommentHistory, VideoIDKey, testVideoID, CommentIDKey, "missing"))
+	suite.assert(res, fiber.StatusNotFound)
+
+	res = suite.jsonReq("PUT", route, videoCommentsPayload{Enabled: false})
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), suite.db.First(&video).Error)
+	assert.False(suite.T(), video.ArchiveComments)
+}
+
+func (suite *TestSuite) TestSearch() {
+	suite.db.Create(&common.Video{ID: "a", Title: "Emperor penguins"})
+	suite.db.Create(&common.VideoHistory{VideoID: "a", Field: "title", Old: "King penguins", New: "Emperor penguins", UpdatedAt: time.Now()})
+
+	var results []*search.Result
+	res := suite.req("GET", RouteSearch+"?q=king")
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&results))
+	if assert.Len(suite.T(), results, 1) {
+		assert.Equal(suite.T(), "a", results[0].VideoID)
+		assert.Equal(suite.T(), "title", results[0].Field)
+		assert.True(suite.T(), results[0].Historic)
+		assert.Equal(suite.T(), "<mark>King</mark> penguins", results[0].Snippet)
+	}
+
+	res = suite.req("GET", RouteSearch+"?q=penguins")
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&results))
+	if assert.Len(suite.T(), results, 2) {
+		assert.False(suite.T(), results[0].Historic)
+	}
+
+	res = suite.req("GET", RouteSearch)
+	suite.assert(res, fiber.StatusBadRequest)
+}
+
+func (suite *TestSuite) TestErrors() {
+	var problem problemResponse
+	res := suite.jsonReq("POST", RouteAddBlobber, newBlobberPayload{})
+	suite.assert(res, fiber.StatusBadRequest)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(suite.T(), fiber.StatusBadRequest, problem.Code)
+	assert.NotEmpty(suite.T(), problem.RequestID)
+	assert.Equal(suite.T(), res.Header.Get(fiber.HeaderXRequestID), problem.RequestID)
+	assert.Equal(suite.T(), []*common.FieldError{
+		{Field: "name", Message: "required"},
+		{Field: "secret", Message: "required"},
+	}, problem.Errors)
+
+	// malformed bodies
+	res = suite.reqAdv("POST", RouteAddBlobber, http.Header{
+		"Content-Type": []string{fiber.MIMEApplicationJSON},
+	}, strings.NewReader(`{"name":`))
+	suite.assert(res, fiber.StatusBadRequest)
+	res = suite.reqAdv("POST", RouteAddVideo, http.Header{
+		"Content-Type": []string{fiber.MIMEApplicationJSON},
+	}, strings.NewReader(`{"videoID":1}`))
+	suite.assert(res, fiber.StatusBadRequest)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&problem))
+	if assert.Len(suite.T(), problem.Errors, 1) {
+		assert.Equal(suite.T(), "videoID", problem.Errors[0].Field)
+	}
+
+	// typed errors and fiber errors
+	res = suite.jsonReq("POST", suite.url(RouteAddBlobberToVideo, VideoIDKey, "a"), newVideoBlobberPayload{BlobberID: 1})
+	suite.assert(res, fiber.StatusNotFound)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(suite.T(), "video 'a' not found", problem.Message)
+
+	res = suite.req("GET", "/nothing")
+	suite.assert(res, fiber.StatusNotFound)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&problem))
+	assert.Equal(suite.T(), fiber.StatusNotFound, problem.Code)
+
+	// server errors don't expose their details
+	problem = newProblem(fiber.NewError(fiber.StatusInternalServerError, "no such table: videos"))
+	assert.Equal(suite.T(), "Internal Server Error", problem.Message)
+	problem = newProblem(errors.New("database is locked"))
+	assert.Equal(suite.T(), fiber.StatusInternalServerError, problem.Code)
+	assert.Equal(suite.T(), "Internal Server Error", problem.Message)
+
+	// failed transactions are rolled back
+	suite.utilCreateBlobber("blobby", "secret")
+	suite.db.Create(&common.Video{ID: "a"})
+	suite.db.Create(&common.Queue{VideoID: "a", BlobberID: 1, Action: common.RemoveBlob, Type: common.VideoBlobType})
+	res = suite.req("DELETE", suite.url(RouteRemoveBlobberFromVideo, VideoIDKey, "a", BlobberIDKey, "1"))
+	suite.assert(res, fiber.StatusConflict)
+	suite.db.Create(&common.BlobLocation{VideoID: "a", BlobDownloaderID: 1, Path: "a", AddedAt: time.Now(), Type: common.VideoBlobType})
+	res = suite.req("DELETE", suite.url(RouteRemoveBlobberFromVideo, VideoIDKey, "a", BlobberIDKey, "1"))
+	suite.assert(res, fiber.StatusConflict)
+	var n int64
+	suite.db.Model(&common.BlobLocation{}).Count(&n)
+	assert.Equal(suite.T(), int64(1), n)
+}
+
+func (suite *TestSuite) TestOpenAPI() {
+	res := suite.req("GET", RouteOpenAPI)
+	suite.assert(res, fiber.StatusOK)
+
+	var spec struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&spec), "decoding spec")
+	assert.True(suite.T(), strings.HasPrefix(spec.OpenAPI, "3."))
+
+	documented := make(map[string]bool)
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	// every registered route must be documented and vice versa
+	registered := make(map[string]bool)
+	for _, routes := range suite.s.app.Stack() {
+		for _, r := range routes {
+			// HEAD is registered implicitly for GET routes, middlewares are registered for "/" and all methods
+			if r.Method == fiber.MethodHead || (r.Path == "/" && r.Method != fiber.MethodGet) {
+				continue
+			}
+			registered[r.Method+" "+openAPIPath(r.Path)] = true
+		}
+	}
+	for route := range registered {
+		assert.True(suite.T(), documented[route], "route %s is not documented", route)
+	}
+	for route := range documented {
+		assert.True(suite.T(), registered[route], "documented route %s is not registered", route)
+	}
+}
+
+// openAPIPath converts the fiber path parameters /:param to /{param}
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func (suite *TestSuite) TestBlobberHeartbeat() {
+	suite.utilCreateBlobber("blobby", "secret")
+	route := suite.url(RouteBlobberHeartbeat, BlobberIDKey, "1")
+
+	res := suite.blobberReq("POST", route, "wrong", BlobberHeartbeatPayload{})
+	suite.assert(res, fiber.StatusUnauthorized)
+
+	res = suite.blobberReq("POST", route, "secret", BlobberHeartbeatPayload{Version: "1.2.3"})
+	suite.assert(res, fiber.StatusOK)
+	var body BlobberHeartbeatResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&body))
+	assert.False(suite.T(), body.Time.IsZero())
+
+	blobber := suite.utilFindBlobber()[0]
+	assert.True(suite.T(), blobber.LastSeen.Valid)
+	assert.Equal(suite.T(), "1.2.3", blobber.Version)
+
+	// the body is optional
+	res = suite.reqAdv("POST", route, http.Header{"Blobber-Secret": []string{"secret"}}, nil)
+	suite.assert(res, fiber.StatusOK)
+	assert.Equal(suite.T(), "1.2.3", suite.utilFindBlobber()[0].Version)
+
+	// storage capacity
+	res = suite.blobberReq("POST", route, "secret", BlobberHeartbeatPayload{TotalBytes: 10 << 30, FreeBytes: 20 << 30})
+	suite.assert(res, fiber.StatusBadRequest)
+	res = suite.blobberReq("POST", route, "secret", BlobberHeartbeatPayload{TotalBytes: 10 << 30, FreeBytes: 512 << 20})
+	suite.assert(res, fiber.StatusOK)
+	body = BlobberHeartbeatResponse{}
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&body))
+	assert.True(suite.T(), body.Full)
+	assert.Equal(suite.T(), []string{"only 512.0 MiB free"}, body.Warnings)
+	blobber = suite.utilFindBlobber()[0]
+	assert.Equal(suite.T(), int64(10<<30), blobber.TotalBytes)
+	assert.Equal(suite.T(), int64(512<<20), blobber.FreeBytes)
+}
+
+func (suite *TestSuite) TestBlobberCapacity() {
+	suite.utilCreateBlobber("blobby", "secret")
+	suite.db.Create(&common.Video{ID: "a"})
+	suite.db.Create(&common.Video{ID: "b"})
+	suite.db.Create(&common.BlobLocation{VideoID: "a", BlobDownloaderID: 1, Path: "a.mp4", AddedAt: time.Now(),
+		Type: common.VideoBlobType, Size: 100})
+
+	res := suite.jsonReq("PUT", suite.url(RouteUpdateBlobber, BlobberIDKey, "1"), blobberUpdatePayload{MaxUsageBytes: -1})
+	suite.assert(res, fiber.StatusBadRequest)
+	res = suite.jsonReq("PUT", suite.url(RouteUpdateBlobber, BlobberIDKey, "2"), blobberUpdatePayload{MaxUsageBytes: 100})
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.jsonReq("PUT", suite.url(RouteUpdateBlobber, BlobberIDKey, "1"), blobberUpdatePayload{MaxUsageBytes: 100})
+	suite.assert(res, fiber.StatusOK)
+
+	res = suite.req("GET", RouteListBlobbers)
+	suite.assert(res, fiber.StatusOK)
+	var list []blobberStatusResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&list))
+	if assert.Len(suite.T(), list, 1) {
+		assert.Equal(suite.T(), int64(100), list[0].UsedBytes)
+		assert.True(suite.T(), list[0].Full)
+		assert.Equal(suite.T(), []string{"max usage of 100 B reached"}, list[0].Warnings)
+	}
+
+	// full blobbers don't receive downloads
+	route := suite.url(RouteAddBlobberToVideo, VideoIDKey, "b")
+	res = suite.jsonReq("POST", route, newVideoBlobberPayload{BlobberID: 1})
+	suite.assert(res, fiber.StatusInsufficientStorage)
+	assert.Len(suite.T(), suite.utilFindQueue(), 0)
+
+	res = suite.jsonReq("PUT", suite.url(RouteUpdateBlobber, BlobberIDKey, "1"), blobberUpdatePayload{MaxUsageBytes: 1000})
+	suite.assert(res, fiber.StatusOK)
+	res = suite.jsonReq("POST", route, newVideoBlobberPayload{BlobberID: 1})
+	suite.assert(res, fiber.StatusCreated)
+	assert.Len(suite.T(), suite.utilFindQueue(), 1)
+}
+
+func (suite *TestSuite) TestClient() {
+	base, shutdown := suite.listen()
+	defer shutdown()
+
+	ctx := context.Background()
+	suite.utilCreateBlobber("blobby", "secret")
+	c := client.New(base, client.WithBlobber(1, "secret"))
+
+	err := c.AddVideo(ctx, &client.NewVideo{VideoID: "nope"})
+	var cerr *client.Error
+	if assert.ErrorAs(suite.T(), err, &cerr) {
+		assert.Equal(suite.T(), fiber.StatusBadRequest, cerr.StatusCode)
+		assert.NotEmpty(suite.T(), cerr.Errors)
+		assert.NotEmpty(suite.T(), cerr.RequestID)
+	}
+	assert.NoError(suite.T(), c.AddVideo(ctx, &client.NewVideo{
+		VideoID:  "https://youtu.be/" + testVideoID,
+		Blobbers: []uint{1},
+	}))
+	err = c.AddVideo(ctx, &client.NewVideo{VideoID: testVideoID})
+	assert.True(suite.T(), client.IsStatus(err, fiber.StatusConflict), "duplicate video: %v", err)
+
+	// downloads are queued by the meta updater
+	suite.db.Create(&common.Queue{VideoID: testVideoID, BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType})
+	pull, err := c.Pull(ctx)
+	if assert.NoError(suite.T(), err, "pull") {
+		assert.Equal(suite.T(), []string{testVideoID}, pull.Download)
+		assert.Len(suite.T(), pull.Jobs, 1)
+	}
+
+	assert.NoError(suite.T(), c.Report(ctx, &client.Report{
+		VideoID: testVideoID,
+		Action:  common.GetBlob,
+		Type:    common.VideoBlobType,
+		Path:    "/blobs/" + testVideoID,
+	}))
+	pull, err = c.Pull(ctx)
+	if assert.NoError(suite.T(), err, "pull") {
+		assert.Empty(suite.T(), pull.Jobs)
+	}
+
+	hb, err := c.Heartbeat(ctx, &client.Heartbeat{Version: "test"})
+	if assert.NoError(suite.T(), err, "heartbeat") {
+		assert.False(suite.T(), hb.Time.IsZero())
+	}
+
+	_, err = client.New(base, client.WithBlobber(1, "wrong")).Pull(ctx)
+	assert.True(suite.T(), client.IsStatus(err, fiber.StatusUnauthorized), "wrong secret: %v", err)
+}
+
+func (suite *TestSuite) TestBlobberSocket() {
+	base, shutdown := suite.listen()
+	defer shutdown()
+
+	ctx := context.Background()
+	suite.utilCreateBlobber("blobby", "secret")
+	suite.db.Create(&common.Video{ID: "a"})
+	suite.db.Create(&common.Video{ID: "b"})
+	suite.db.Create(&common.Queue{VideoID: "a", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType})
+
+	// no upgrade
+	res := suite.blobberReq("GET", suite.url(RouteBlobberSocket, BlobberIDKey, "1"), "secret", nil)
+	suite.assert(res, fiber.StatusUpgradeRequired)
+	// wrong secret
+	_, err := client.New(base, client.WithBlobber(1, "wrong")).Connect(ctx)
+	assert.True(suite.T(), client.IsStatus(err, fiber.StatusUnauthorized), "wrong secret: %v", err)
+
+	sock, err := client.New(base, client.WithBlobber(1, "secret")).Connect(ctx)
+	if !assert.NoError(suite.T(), err, "connect") {
+		return
+	}
+	defer sock.Close()
+
+	// queue is pushed after connecting
+	jobA := client.Job{VideoID: "a", Action: common.GetBlob, Type: common.VideoBlobType}
+	msg := suite.readSocket(sock)
+	assert.Equal(suite.T(), client.SocketJobs, msg.Type)
+	assert.Equal(suite.T(), []client.Job{jobA}, msg.Jobs)
+
+	id, err := sock.Ack(msg.Jobs)
+	assert.NoError(suite.T(), err)
+	msg = suite.readSocket(sock)
+	assert.Equal(suite.T(), client.SocketResult, msg.Type)
+	assert.Equal(suite.T(), id, msg.ID)
+	assert.Nil(suite.T(), msg.Error)
+	assert.True(suite.T(), suite.utilFindQueue()[0].AckedAt.Valid)
+
+	// enqueued jobs are pushed immediately
+	_, err = tasks.Enqueue(suite.db, &common.Queue{VideoID: "b", BlobberID: 1, Action: common.GetBlob, Type: common.ThumbnailBlobType})
+	assert.NoError(suite.T(), err)
+	msg = suite.readSocket(sock)
+	assert.Equal(suite.T(), []client.Job{{VideoID: "b", Action: common.GetBlob, Type: common.ThumbnailBlobType}}, msg.Jobs)
+
+	// progress and report
+	_, err = sock.Progress(&client.Progress{VideoID: "a", Action: common.GetBlob, Type: common.VideoBlobType, BytesDone: 1})
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), suite.readSocket(sock).Error)
+	_, err = sock.Report(&client.Report{VideoID: "a", Action: common.GetBlob, Type: common.VideoBlobType, Path: "/a"})
+	assert.NoError(suite.T(), err)
+	assert.Nil(suite.T(), suite.readSocket(sock).Error)
+	assert.Len(suite.T(), suite.utilFindQueue(), 1)
+
+	// invalid messages
+	_, err = sock.Send(&client.SocketMessage{Type: "nope"})
+	assert.NoError(suite.T(), err)
+	if msg = suite.readSocket(sock); assert.NotNil(suite.T(), msg.Error) {
+		assert.Equal(suite.T(), fiber.StatusBadRequest, msg.Error.StatusCode)
+	}
+	_, err = sock.Report(&client.Report{VideoID: "a"})
+	assert.NoError(suite.T(), err)
+	if msg = suite.readSocket(sock); assert.NotNil(suite.T(), msg.Error) {
+		assert.NotEmpty(suite.T(), msg.Error.Errors)
+	}
+}
+
+func (suite *TestSuite) TestBlobberProgress() {
+	suite.utilCreateBlobber("blobby", "secret")
+	suite.db.Create(&common.Video{ID: "a"})
+	suite.db.Create(&common.Queue{VideoID: "a", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType})
+	suite.db.Create(&common.Queue{VideoID: "b", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType})
+	route := suite.url(RouteBlobberProgress, BlobberIDKey, "1")
+
+	res := suite.blobberReq("POST", route, "secret", BlobberProgressPayload{
+		VideoID: "a", Stage: "downloading", BytesDone: 50, BytesTotal: 100, ETA: 5,
+	})
+	suite.assert(res, fiber.StatusOK)
+
+	// unknown job and invalid progress
+	res = suite.blobberReq("POST", route, "secret", BlobberProgressPayload{VideoID: "c"})
+	suite.assert(res, fiber.StatusNotFound)
+	res = suite.blobberReq("POST", route, "secret", BlobberProgressPayload{VideoID: "a", BytesDone: -1})
+	suite.assert(res, fiber.StatusBadRequest)
+
+	// queue
+	var queue []queueItemResponse
+	res = suite.req("GET", RouteListQueue+"?active=yes")
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&queue))
+	if assert.Len(suite.T(), queue, 1) && assert.NotNil(suite.T(), queue[0].Progress) {
+		assert.Equal(suite.T(), "a", queue[0].VideoID)
+		assert.Equal(suite.T(), "downloading", queue[0].Progress.Stage)
+		assert.Equal(suite.T(), int64(50), queue[0].Progress.BytesDone)
+		assert.Equal(suite.T(), int64(5), queue[0].Progress.ETA)
+	}
+	res = suite.req("GET", RouteListQueue+"?blobber=1")
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&queue))
+	assert.Len(suite.T(), queue, 2)
+	res = suite.req("GET", RouteListQueue+"?blobber=x")
+	suite.assert(res, fiber.StatusBadRequest)
+
+	// video detail
+	var video struct {
+		ID    string
+		Queue []queueItemResponse `json:"queue"`
+	}
+	res = suite.req("GET", suite.url(RouteGetVideo, VideoIDKey, "a"))
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&video))
+	assert.Equal(suite.T(), "a", video.ID)
+	if assert.Len(suite.T(), video.Queue, 1) && assert.NotNil(suite.T(), video.Queue[0].Progress) {
+		assert.Equal(suite.T(), int64(100), video.Queue[0].Progress.BytesTotal)
+	}
+}
+
+func (suite *TestSuite) TestRateLimits() {
+	suite.utilCreateBlobber("blobby", "secret")
+	pull := suite.url(RouteBlobberPull, BlobberIDKey, "1")
+	heartbeat := suite.url(RouteBlobberHeartbeat, BlobberIDKey, "1")
+	secret := func(s string) http.Header {
+		return http.Header{"Blobber-Secret": []string{s}}
+	}
+
+	// client address
+	suite.setLimits(RateLimits{IPInterval: time.Hour, IPBurst: 2})
+	suite.assert(suite.req("GET", RouteHealth), fiber.StatusOK)
+	suite.assert(suite.req("GET", RouteHealth), fiber.StatusOK)
+	res := suite.req("GET", RouteHealth)
+	suite.assert(res, fiber.StatusTooManyRequests)
+	assert.Equal(suite.T(), "3600", res.Header.Get(fiber.HeaderRetryAfter))
+
+	// blobbers are told their poll interval
+	suite.setLimits(RateLimits{PullInterval: time.Minute, PullBurst: 1})
+	res = suite.reqAdv("GET", pull, secret("secret"), nil)
+	suite.assert(res, fiber.StatusOK)
+	var body BlobberPullResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(suite.T(), 60, body.PollInterval)
+	var seen common.BlobDownloader
+	assert.NoError(suite.T(), suite.db.First(&seen, 1).Error)
+	res = suite.reqAdv("GET", pull, secret("secret"), nil)
+	suite.assert(res, fiber.StatusTooManyRequests)
+	assert.Equal(suite.T(), "60", res.Header.Get(fiber.HeaderRetryAfter))
+	// rejected pulls don't update the last seen timestamp
+	var rejected common.BlobDownloader
+	assert.NoError(suite.T(), suite.db.First(&rejected, 1).Error)
+	assert.Equal(suite.T(), seen.LastSeen, rejected.LastSeen)
+
+	// blobber credential
+	suite.setLimits(RateLimits{BlobberInterval: time.Minute, BlobberBurst: 1})
+	suite.assert(suite.blobberReq("POST", heartbeat, "secret", BlobberHeartbeatPayload{}), fiber.StatusOK)
+	suite.assert(suite.blobberReq("POST", heartbeat, "secret", BlobberHeartbeatPayload{}), fiber.StatusTooManyRequests)
+
+	// a correct secret forgets previous wrong secrets
+	suite.setLimits(RateLimits{MaxBadSecrets: 2, BadSecretWindow: time.Minute, LockoutDuration: time.Hour})
+	suite.assert(suite.blobberReq("POST", heartbeat, "wrong", BlobberHeartbeatPayload{}), fiber.StatusUnauthorized)
+	suite.assert(suite.blobberReq("POST", heartbeat, "secret", BlobberHeartbeatPayload{}), fiber.StatusOK)
+	suite.assert(suite.blobberReq("POST", heartbeat, "wrong", BlobberHeartbeatPayload{}), fiber.StatusUnauthorized)
+	suite.assert(suite.blobberReq("POST", heartbeat, "secret", BlobberHeartbeatPayload{}), fiber.StatusOK)
+
+	// wrong secrets lock out the client address from the blobber, even with the right secret
+	suite.assert(suite.blobberReq("POST", heartbeat, "wrong", BlobberHeartbeatPayload{}), fiber.StatusUnauthorized)
+	suite.assert(suite.blobberReq("POST", heartbeat, "wrong", BlobberHeartbeatPayload{}), fiber.StatusUnauthorized)
+	res = suite.blobberReq("POST", heartbeat, "secret", BlobberHeartbeatPayload{})
+	suite.assert(res, fiber.StatusTooManyRequests)
+	assert.Equal(suite.T(), "3600", res.Header.Get(fiber.HeaderRetryAfter))
+	// other blobbers behind the same address aren't locked out
+	suite.utilCreateBlobber("other", "other")
+	other := suite.url(RouteBlobberHeartbeat, BlobberIDKey, "2")
+	suite.assert(suite.blobberReq("POST", other, "other", BlobberHeartbeatPayload{}), fiber.StatusOK)
+}
+
+func (suite *TestSuite) TestAudit() {
+	suite.db.Create(&common.APIKey{Key: "admin"})
+	suite.utilCreateBlobber("blobby", "secret")
+	admin := http.Header{
+		"Content-Type":  []string{fiber.MIMEApplicationJSON},
+		"Authorization": []string{"Bearer admin"},
+	}
+	res := suite.reqAdv("POST", RouteAddVideo, admin, strings.NewReader(`{"videoID": "`+testVideoID+`", "blobbers": [1]}`))
+	suite.assert(res, fiber.StatusCreated)
+
+	// the reason is read from the body ...
+	route := suite.url(RouteRemoveBlobberFromVideo, VideoIDKey, testVideoID, BlobberIDKey, "1")
+	res = suite.reqAdv("DELETE", route, admin, strings.NewReader(`{"reason": "decommissioned"}`))
+	suite.assert(res, fiber.StatusCreated)
+
+	// ... or the header
+	route = suite.url(RouteDeleteVideo, VideoIDKey, testVideoID)
+	res = suite.reqAdv("DELETE", route, http.Header{
+		"Authorization":   []string{"Bearer unknown"},
+		AuditReasonHeader: []string{"spam"},
+	}, nil)
+	suite.assert(res, fiber.StatusCreated)
+
+	// failed requests and blobber requests aren't recorded
+	suite.assert(suite.req("DELETE", route), fiber.StatusNotFound)
+	heartbeat := suite.url(RouteBlobberHeartbeat, BlobberIDKey, "1")
+	suite.assert(suite.blobberReq("POST", heartbeat, "secret", BlobberHeartbeatPayload{}), fiber.StatusOK)
+
+	res = suite.req("GET", RouteListAudit)
+	suite.assert(res, fiber.StatusOK)
+	var logs []auditLogResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&logs))
+	if assert.Len(suite.T(), logs, 4) {
+		assert.Equal(suite.T(), "video.disable", logs[0].Action)
+		assert.Equal(suite.T(), "video:"+testVideoID, logs[0].Target)
+		assert.True(suite.T(), strings.HasPrefix(logs[0].Actor, "token:"))
+		assert.NotContains(suite.T(), logs[0].Actor, "unknown")
+		assert.Equal(suite.T(), "spam", logs[0].Reason)
+		assert.JSONEq(suite.T(), `{"title": "", "channelID": "", "disabled": false}`, string(logs[0].Before))
+		assert.JSONEq(suite.T(), `{"title": "", "channelID": "", "disabled": true}`, string(logs[0].After))
+
+		assert.Equal(suite.T(), "video.blobber_remove", logs[1].Action)
+		assert.Equal(suite.T(), "key:1", logs[1].Actor)
+		assert.Equal(suite.T(), "decommissioned", logs[1].Reason)
+		assert.JSONEq(suite.T(), `{"blobberID": 1}`, string(logs[1].Before))
+		assert.Empty(suite.T(), logs[1].After)
+
+		assert.Equal(suite.T(), "video.add", logs[2].Action)
+		assert.Equal(suite.T(), "blobber.add", logs[3].Action)
+		assert.Equal(suite.T(), "blobber:1", logs[3].Target)
+		assert.Equal(suite.T(), "anonymous", logs[3].Actor)
+		assert.NotContains(suite.T(), string(logs[3].After), "secret")
+	}
+
+	res = suite.req("GET", RouteListAudit+"?actor=key:1&target=video:"+testVideoID)
+	suite.assert(res, fiber.StatusOK)
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&logs))
+	assert.Len(suite.T(), logs, 2)
+	suite.assert(suite.req("GET", RouteListAudit+"?since=yesterday"), fiber.StatusBadRequest)
+}
+
+func (suite *TestSuite) TestMetrics() {
+	// issue a request so the latency histogram has a sample
+	suite.req("GET", "/")
+
+	res := suite.req("GET", RouteMetrics)
+	suite.assert(res, fiber.StatusOK)
+
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(suite.T(), err, "reading metrics")
+	assert.Contains(suite.T(), string(body), "penguin_http_request_duration_seconds")
+	assert.Contains(suite.T(), string(body), "penguin_meta_update_duration_seconds")
+}
+
+func (suite *TestSuite) TestHealth() {
+	res := suite.req("GET", RouteHealth)
+	suite.assert(res, fiber.StatusOK)
+
+	// suite server has no updater status
+	res = suite.req("GET", RouteReady)
+	suite.assert(res, fiber.StatusServiceUnavailable)
+
+	// running updater
+	status := tasks.NewStatus()
+	status.Start()
+	s := New(suite.db, WithUpdaterStatus(status))
+	res, err := s.app.Test(httptest.NewRequest("GET", RouteReady, nil), -1)
+	assert.NoError(suite.T(), err, "fiber test")
+	suite.assert(res, fiber.StatusOK)
+
+	// stale meta update
+	status.Finish(time.Now().Add(-2*time.Second), &tasks.APIError{Err: errors.New("quotaExceeded")})
+	s = New(suite.db, WithUpdaterStatus(status), WithReadyThreshold(time.Nanosecond))
+	res, err = s.app.Test(httptest.NewRequest("GET", RouteReady, nil), -1)
+	assert.NoError(suite.T(), err, "fiber test")
+	suite.assert(res, fiber.StatusServiceUnavailable)
+
+	var body healthResponse
+	assert.NoError(suite.T(), json.NewDecoder(res.Body).Decode(&body), "decoding readiness")
+	assert.True(suite.T(), body.Checks["database"].OK)
+	assert.True(suite.T(), body.Checks["migrations"].OK)
+	assert.False(suite.T(), body.Checks["metaUpdate"].OK)
+	assert.Equal(suite.T(), "quotaExceeded", body.Checks["youtube"].Error)
+
+	// other errors of the meta update don't make YouTube unreachable
+	status.Finish(time.Now(), errors.New("database is locked"))
+	s = New(suite.db, WithUpdaterStatus(status))
+	res, err = s.app.Test(httptest.NewRequest("GET", RouteReady, nil), -1)
+	assert.NoError(suite.T(), err, "fiber test")
+	suite.assert(res, fiber.StatusOK)
+}
+
+// eventStream opens the event stream at url and returns its body,
+// nil if the stream couldn't be opened
+func (suite *TestSuite) eventStream(url, lastID string) *bufio.Reader {
+	req, err := http.NewRequest("GET", url, nil)
+	assert.NoError(suite.T(), err, "creating request")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	res, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	suite.T().Cleanup(func() {
+		_ = res.Body.Close()
+	})
+	if res.StatusCode != fiber.StatusOK {
+		return nil
+	}
+	assert.Equal(suite.T(), "text/event-stream", res.Header.Get(fiber.HeaderContentType))
+	return bufio.NewReader(res.Body)
+}
+
+// nextEvent reads the next event of the stream, comments are skipped
+func (suite *TestSuite) nextEvent(r *bufio.Reader) string {
+	var event strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			suite.T().Fatal(err)
+		}
+		if line == "\n" && event.Len() > 0 {
+			return event.String()
+		}
+		if !strings.HasPrefix(line, ":") && line != "\n" {
+			event.WriteString(line)
+		}
+	}
+}
+
+// listen serves a new server on a random port and returns its base URL
+func (suite *TestSuite) listen(opts ...Option) (base string, shutdown func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		suite.T().Fatal(err)
+	}
+	s := New(suite.db, opts...)
+	go func() {
+		_ = s.app.Listener(ln)
+	}()
+	return "http://" + ln.Addr().String(), func() {
+		_ = s.Shutdown()
+	}
+}
+
+// readSocket reads the next message from the socket or fails after a second
+func (suite *TestSuite) readSocket(sock *client.Socket) *client.SocketMessage {
+	ch := make(chan *client.SocketMessage, 1)
+	go func() {
+		msg, err := sock.Read()
+		assert.NoError(suite.T(), err, "reading socket")
+		ch <- msg
+	}()
+	select {
+	case msg := <-ch:
+		if msg == nil {
+			suite.T().FailNow()
+		}
+		return msg
+	case <-time.After(time.Second):
+		suite.T().Fatal("timeout reading socket")
+		return nil
+	}
 }
 
 func (suite *TestSuite) assert(res *http.Response, status int) {
@@ -131,6 +1478,11 @@ func (suite *TestSuite) utilFindBlobber() []*common.BlobDownloader {
 	return blobber
 }
 
+func (suite *TestSuite) utilCreateBlobber(name, secret string) {
+	res := suite.jsonReq("POST", RouteAddBlobber, newBlobberPayload{Name: name, Secret: secret})
+	suite.assert(res, fiber.StatusCreated)
+}
+
 func (suite *TestSuite) utilFindQueue() []*common.Queue {
 	var queues []*common.Queue
 	err := suite.db.Model(&common.Queue{}).Find(&queues).Error
@@ -148,6 +1500,15 @@ func (suite *TestSuite) jsonReq(typ, route string, val interface{}) *http.Respon
 	}, bytes.NewReader(data))
 }
 
+func (suite *TestSuite) blobberReq(typ, route, secret string, val interface{}) *http.Response {
+	data, err := json.Marshal(val)
+	assert.NoError(suite.T(), err, "marshal data")
+	return suite.reqAdv(typ, route, http.Header{
+		"Content-Type":   []string{fiber.MIMEApplicationJSON},
+		"Blobber-Secret": []string{secret},
+	}, bytes.NewReader(data))
+}
+
 func (suite *TestSuite) req(typ, route string) *http.Response {
 	return suite.reqAdv(typ, route, nil, nil)
 }
@@ -0,0 +1,189 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"html"
+	"strings"
+)
+
+var (
+	ErrEmptyQuery  = errors.New("empty search query")
+	ErrUnsupported = errors.New("full-text search is not supported by the database")
+)
+
+const (
+	// indexTable is the SQLite full-text index of current and historic video meta data
+	indexTable = "search_index"
+
+	// SnippetStart and SnippetEnd enclose the matched terms in snippets
+	SnippetStart = "<mark>"
+	SnippetEnd   = "</mark>"
+	// snippetStart and snippetEnd are requested from SQLite and replaced after the snippet was escaped
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+	// snippetTokens is the maximum number of tokens of a snippet
+	snippetTokens = 16
+)
+
+// Result is a single matched field of a video
+type Result struct {
+	VideoID string `json:"videoID"`
+	Title   string `json:"title"`
+	// Field is either title, description or tags
+	Field string `json:"field"`
+	// Historic is set if a previous value of the field matched, HistoryID references the VideoHistory
+	Historic  bool `json:"historic"`
+	HistoryID uint `json:"historyID,omitempty"`
+	// Snippet is HTML, the text is escaped and only the markers are tags
+	Snippet string `json:"snippet"`
+}
+
+// Migrate creates the full-text index for the database
+func Migrate(db *gorm.DB) (err error) {
+	if db.Dialector.Name() != "sqlite" {
+		return ErrUnsupported
+	}
+	return migrateSQLite(db)
+}
+
+// Search returns the fields of enabled videos which match all terms of the query.
+// Current values are ranked before historic values.
+func Search(db *gorm.DB, query string, limit, offset int) (res []*Result, err error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	if db.Dialector.Name() != "sqlite" {
+		return nil, ErrUnsupported
+	}
+	rows, err := searchSQLite(db, terms, limit, offset)
+	if err != nil {
+		return
+	}
+
+	res = make([]*Result, len(rows))
+	for i, r := range rows {
+		res[i] = &Result{
+			VideoID:   r.VideoID,
+			Title:     r.Title,
+			Field:     r.Field,
+			Historic:  r.HistoryID != 0,
+			HistoryID: r.HistoryID,
+			Snippet:   highlight(r.Snippet),
+		}
+	}
+	return
+}
+
+type row struct {
+	VideoID   string
+	Title     string
+	Field     string
+	HistoryID uint
+	Snippet   string
+}
+
+// historyFieldName maps the fields of VideoHistory to the names used in results
+const historyFieldName = `CASE %[1]s WHEN 'desc' THEN 'description' ELSE %[1]s END`
+
+// historyFields are the fields of VideoHistory which are indexed
+const historyFields = `('title', 'desc', 'tags')`
+
+// highlight escapes a snippet and replaces the markers of matched terms with tags
+func highlight(snippet string) string {
+	return strings.NewReplacer(snippetStart, SnippetStart, snippetEnd, SnippetEnd).
+		Replace(html.EscapeString(snippet))
+}
+
+//// SQLite
+
+// migrateSQLite creates the FTS5 index, or FTS4 if SQLite was built without FTS5,
+// and the triggers which keep the index in sync with videos and video_histories
+func migrateSQLite(db *gorm.DB) (err error) {
+	if !db.Migrator().HasTable(indexTable) {
+		create := fmt.Sprintf(
+			"CREATE VIRTUAL TABLE %s USING fts5(video_id UNINDEXED, field UNINDEXED, history_id UNINDEXED, content)",
+			indexTable)
+		if err = db.Exec(create).Error; err != nil {
+			create = fmt.Sprintf(
+				"CREATE VIRTUAL TABLE %s USING fts4(video_id, field, history_id, content, "+
+					"notindexed=video_id, notindexed=field, notindexed=history_id)",
+				indexTable)
+			if err = db.Exec(create).Error; err != nil {
+				return
+			}
+		}
+
+		// index existing videos
+		if err = db.Exec(fmt.Sprintf(`INSERT INTO %s (video_id, field, history_id, content)
+			SELECT id, 'title', 0, title FROM videos
+			UNION ALL SELECT id, 'description', 0, description FROM videos
+			UNION ALL SELECT id, 'tags', 0, tags FROM videos
+			UNION ALL SELECT video_id, `+fmt.Sprintf(historyFieldName, "field")+`, id, old FROM video_histories
+				WHERE field IN `+historyFields,
+			indexTable)).Error; err != nil {
+			return
+		}
+	}
+
+	insertVideo := fmt.Sprintf(`INSERT INTO %s (video_id, field, history_id, content) VALUES
+		(new.id, 'title', 0, new.title),
+		(new.id, 'description', 0, new.description),
+		(new.id, 'tags', 0, new.tags);`, indexTable)
+
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS search_videos_ai AFTER INSERT ON videos BEGIN ` + insertVideo + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS search_videos_au AFTER UPDATE OF title, description, tags ON videos BEGIN ` +
+			fmt.Sprintf(`DELETE FROM %s WHERE video_id = old.id AND history_id = 0;`, indexTable) +
+			insertVideo + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS search_videos_ad AFTER DELETE ON videos BEGIN ` +
+			fmt.Sprintf(`DELETE FROM %s WHERE video_id = old.id;`, indexTable) + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS search_histories_ai AFTER INSERT ON video_histories ` +
+			`WHEN new.field IN ` + historyFields + ` BEGIN ` +
+			fmt.Sprintf(`INSERT INTO %s (video_id, field, history_id, content) VALUES (new.video_id, `, indexTable) +
+			fmt.Sprintf(historyFieldName, "new.field") + `, new.id, new.old); END`,
+		`CREATE TRIGGER IF NOT EXISTS search_histories_ad AFTER DELETE ON video_histories BEGIN ` +
+			fmt.Sprintf(`DELETE FROM %s WHERE history_id = old.id;`, indexTable) + ` END`,
+	}
+	for _, t := range triggers {
+		if err = db.Exec(t).Error; err != nil {
+			return
+		}
+	}
+	return
+}
+
+func searchSQLite(db *gorm.DB, terms []string, limit, offset int) (rows []*row, err error) {
+	// quote terms to prevent syntax errors in the match expression
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+
+	var schema string
+	if err = db.Raw("SELECT sql FROM sqlite_master WHERE name = ?", indexTable).Scan(&schema).Error; err != nil {
+		return
+	}
+
+	// FTS4 has neither ranking nor the same snippet signature as FTS5
+	var snippet, order string
+	if strings.Contains(strings.ToLower(schema), "fts5") {
+		snippet = fmt.Sprintf("snippet(%s, 3, ?, ?, '…', %d)", indexTable, snippetTokens)
+		order = fmt.Sprintf("%s.history_id <> 0, rank", indexTable)
+	} else {
+		snippet = fmt.Sprintf("snippet(%s, ?, ?, '…', 3, %d)", indexTable, snippetTokens)
+		order = fmt.Sprintf("%s.history_id <> 0, %[1]s.video_id", indexTable)
+	}
+
+	err = db.Raw(fmt.Sprintf(`SELECT %[1]s.video_id, videos.title, %[1]s.field, %[1]s.history_id, `+snippet+` AS snippet
+		FROM %[1]s JOIN videos ON videos.id = %[1]s.video_id AND videos.deleted_at IS NULL
+		WHERE %[1]s MATCH ?
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?`, indexTable),
+		snippetStart, snippetEnd, strings.Join(quoted, " "), limit, offset).
+		Scan(&rows).Error
+	return
+}
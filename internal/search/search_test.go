@@ -0,0 +1,99 @@
+package search
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(common.TableModels...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSearch(t *testing.T) {
+	db := openDB(t)
+
+	// videos which existed before the index was created are indexed on migration
+	assert.NoError(t, db.Create(&common.Video{ID: "a", Title: "Emperor penguins", Tags: "antarctica,birds"}).Error)
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, Migrate(db))
+
+	assert.NoError(t, db.Create(&common.Video{ID: "b", Title: "Seals", Description: "Seals hunting penguins"}).Error)
+	assert.NoError(t, db.Create(&common.Video{ID: "c", Title: "Hidden penguins"}).Error)
+	assert.NoError(t, db.Delete(&common.Video{ID: "c"}).Error)
+
+	res, err := Search(db, "penguins", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 2) {
+		assert.ElementsMatch(t, []string{"a", "b"}, []string{res[0].VideoID, res[1].VideoID})
+		for _, r := range res {
+			assert.False(t, r.Historic)
+			assert.Contains(t, r.Snippet, SnippetStart+"penguins"+SnippetEnd)
+		}
+	}
+
+	res, err = Search(db, "antarctica", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "tags", res[0].Field)
+	}
+
+	// title changes are searchable by their previous value
+	assert.NoError(t, db.Model(&common.Video{ID: "b"}).Update("Title", "Leopard seals").Error)
+	assert.NoError(t, db.Create(&common.VideoHistory{
+		VideoID: "b", Field: "title", Old: "Seals", New: "Leopard seals", UpdatedAt: time.Now(),
+	}).Error)
+	assert.NoError(t, db.Create(&common.VideoHistory{
+		VideoID: "b", Field: "desc", Old: "Seals at the shore", New: "Seals hunting penguins", UpdatedAt: time.Now(),
+	}).Error)
+
+	res, err = Search(db, "leopard", 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	res, err = Search(db, "seals", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 4) {
+		// current values first
+		assert.False(t, res[0].Historic)
+		assert.False(t, res[1].Historic)
+		assert.True(t, res[2].Historic)
+		assert.True(t, res[3].Historic)
+		assert.ElementsMatch(t, []string{"title", "description"}, []string{res[2].Field, res[3].Field})
+		assert.Equal(t, "Leopard seals", res[2].Title)
+	}
+
+	res, err = Search(db, "seals shore", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "description", res[0].Field)
+		assert.True(t, res[0].Historic)
+	}
+
+	// snippets are escaped, only the markers are html
+	assert.NoError(t, db.Create(&common.Video{ID: "x", Title: `<script>alert("walrus")</script>`}).Error)
+	res, err = Search(db, "walrus", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, res, 1) {
+		assert.NotContains(t, res[0].Snippet, "<script>")
+		assert.Contains(t, res[0].Snippet, "&lt;script&gt;")
+		assert.Contains(t, res[0].Snippet, SnippetStart+"walrus"+SnippetEnd)
+	}
+
+	// syntax of the match expression is escaped
+	_, err = Search(db, `"penguins OR (`, 10, 0)
+	assert.NoError(t, err)
+
+	_, err = Search(db, "  ", 10, 0)
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+}
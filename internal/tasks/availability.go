@@ -0,0 +1,93 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"google.golang.org/api/youtube/v3"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RegionCode is the ISO 3166-1 alpha-2 code of the region the blobbers download from.
+// It is used to detect region-blocked videos.
+var RegionCode = "US"
+
+// OEmbedURL is the endpoint used to check the availability of videos
+// which are not returned by the YouTube Data API
+var OEmbedURL = "https://www.youtube.com/oembed"
+
+var oEmbedClient = &http.Client{Timeout: 10 * time.Second}
+
+// availabilityOf determines the availability of a video returned by the YouTube Data API
+func availabilityOf(r *youtube.Video) common.Availability {
+	if r.Status != nil && r.Status.PrivacyStatus == "private" {
+		return common.PrivateAvailability
+	}
+	if det := r.ContentDetails; det != nil {
+		if res := det.RegionRestriction; res != nil && regionBlocked(res, RegionCode) {
+			return common.RegionBlockedAvailability
+		}
+		if det.ContentRating != nil && det.ContentRating.YtRating == "ytAgeRestricted" {
+			return common.AgeGatedAvailability
+		}
+	}
+	return common.AvailableAvailability
+}
+
+// regionBlocked checks if the region restriction applies to region
+func regionBlocked(res *youtube.VideoContentDetailsRegionRestriction, region string) bool {
+	for _, r := range res.Blocked {
+		if r == region {
+			return true
+		}
+	}
+	if len(res.Allowed) == 0 {
+		return false
+	}
+	for _, r := range res.Allowed {
+		if r == region {
+			return false
+		}
+	}
+	return true
+}
+
+// fallbackAvailability checks the availability of a video which is not returned by the API
+// using the oEmbed endpoint: private videos respond with 401/403, deleted videos with 400/404.
+// ok is false if the availability couldn't be determined.
+func fallbackAvailability(videoID string) (availability common.Availability, ok bool, err error) {
+	q := url.Values{}
+	q.Set("format", "json")
+	q.Set("url", "https://www.youtube.com/watch?v="+videoID)
+
+	var resp *http.Response
+	if resp, err = oEmbedClient.Get(OEmbedURL + "?" + q.Encode()); err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return common.PrivateAvailability, true, nil
+	case http.StatusBadRequest, http.StatusNotFound:
+		return common.DeletedAvailability, true, nil
+	}
+	return
+}
+
+// missingAvailability returns the availability of a video which is not returned by the API.
+// If the fallback is inconclusive (e.g. a network error or rate limit) the previous availability is kept,
+// so transient errors don't flip the video back and forth. Videos without a known availability are assumed private.
+func missingAvailability(videoID string, previous common.Availability) common.Availability {
+	a, ok, err := fallbackAvailability(videoID)
+	if err == nil && ok {
+		return a
+	}
+	if previous == 0 {
+		log.WithError(err).Warnf("[Video %s] cannot determine availability, assuming private", videoID)
+		return common.PrivateAvailability
+	}
+	log.WithError(err).Warnf("[Video %s] cannot determine availability, keeping %s", videoID, previous)
+	return previous
+}
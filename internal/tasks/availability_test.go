@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/youtube/v3"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAvailabilityOf(t *testing.T) {
+	assert.Equal(t, common.AvailableAvailability, availabilityOf(&youtube.Video{
+		Status: &youtube.VideoStatus{PrivacyStatus: "public"},
+	}))
+	assert.Equal(t, common.PrivateAvailability, availabilityOf(&youtube.Video{
+		Status: &youtube.VideoStatus{PrivacyStatus: "private"},
+	}))
+	assert.Equal(t, common.AgeGatedAvailability, availabilityOf(&youtube.Video{
+		ContentDetails: &youtube.VideoContentDetails{
+			ContentRating: &youtube.ContentRating{YtRating: "ytAgeRestricted"},
+		},
+	}))
+	assert.Equal(t, common.RegionBlockedAvailability, availabilityOf(&youtube.Video{
+		ContentDetails: &youtube.VideoContentDetails{
+			RegionRestriction: &youtube.VideoContentDetailsRegionRestriction{Blocked: []string{RegionCode}},
+		},
+	}))
+}
+
+func TestRegionBlocked(t *testing.T) {
+	res := &youtube.VideoContentDetailsRegionRestriction{Blocked: []string{"DE"}}
+	assert.True(t, regionBlocked(res, "DE"))
+	assert.False(t, regionBlocked(res, "US"))
+
+	res = &youtube.VideoContentDetailsRegionRestriction{Allowed: []string{"DE"}}
+	assert.False(t, regionBlocked(res, "DE"))
+	assert.True(t, regionBlocked(res, "US"))
+}
+
+func TestFallbackAvailability(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Query().Get("url"), "private"):
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.Contains(r.URL.Query().Get("url"), "deleted"):
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	orig := OEmbedURL
+	OEmbedURL = srv.URL
+	defer func() { OEmbedURL = orig }()
+
+	a, ok, err := fallbackAvailability("private")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, common.PrivateAvailability, a)
+
+	a, ok, err = fallbackAvailability("deleted")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, common.DeletedAvailability, a)
+
+	_, ok, err = fallbackAvailability("public")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// inconclusive results keep the previous availability
+	assert.Equal(t, common.DeletedAvailability, missingAvailability("public", common.DeletedAvailability))
+	assert.Equal(t, common.PrivateAvailability, missingAvailability("public", 0))
+	assert.Equal(t, common.DeletedAvailability, missingAvailability("deleted", common.PrivateAvailability))
+}
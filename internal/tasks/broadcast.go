@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/pkg/common"
+	"google.golang.org/api/youtube/v3"
+	"time"
+)
+
+// broadcastStateOf determines the broadcast state of a video returned by the YouTube Data API
+func broadcastStateOf(r *youtube.Video) common.BroadcastState {
+	if r.Snippet != nil {
+		switch r.Snippet.LiveBroadcastContent {
+		case "upcoming":
+			return common.UpcomingBroadcastState
+		case "live":
+			return common.LiveBroadcastState
+		}
+	}
+	// videos which were streamed keep their live streaming details
+	if r.LiveStreamingDetails != nil {
+		return common.CompletedBroadcastState
+	}
+	return common.NoneBroadcastState
+}
+
+// parseNullTime parses a RFC3339 timestamp returned by the API, empty values are null
+func parseNullTime(s string) sql.NullTime {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return sql.NullTime{Valid: true, Time: t}
+	}
+	return sql.NullTime{}
+}
+
+// formatNullTime formats a timestamp for the video history
+func formatNullTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
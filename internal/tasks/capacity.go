@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+const (
+	// MinFreeBytes is the free space a blobber has to keep to receive downloads
+	MinFreeBytes = 1 << 30
+	// WarnUsageRatio is the usage of the capacity of a blobber which is warned about
+	WarnUsageRatio = 0.9
+	// DefaultBlobBytes is the estimated size of a queued download if no blob of its type was stored yet
+	DefaultBlobBytes = 100 << 20
+)
+
+// Capacity is the storage usage of a blobber
+type Capacity struct {
+	// UsedBytes is the size of all blobs stored by the blobber
+	UsedBytes int64
+	// PendingBytes is the estimated size of the queued downloads of the blobber
+	PendingBytes int64
+	// Full blobbers don't receive downloads, Warnings describe full and nearly full storage
+	Full     bool
+	Warnings []string
+}
+
+// BlobberCapacity sums up the stored blobs and queued downloads of the blobber and checks its limits
+func BlobberCapacity(db *gorm.DB, b *common.BlobDownloader) (c *Capacity, err error) {
+	c = new(Capacity)
+	if err = db.Model(&common.BlobLocation{}).
+		Where(&common.BlobLocation{BlobDownloaderID: b.ID}).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&c.UsedBytes).Error; err != nil {
+		return
+	}
+	if c.PendingBytes, err = pendingBytes(db, b.ID); err != nil {
+		return
+	}
+
+	// queued downloads are counted, otherwise an empty blobber could receive every download at once
+	used, free := c.UsedBytes+c.PendingBytes, b.FreeBytes-c.PendingBytes
+	if b.MaxUsageBytes > 0 {
+		if used >= b.MaxUsageBytes {
+			c.Full = true
+			c.Warnings = append(c.Warnings, "max usage of "+formatBytes(b.MaxUsageBytes)+" reached")
+		} else if float64(used) >= WarnUsageRatio*float64(b.MaxUsageBytes) {
+			c.Warnings = append(c.Warnings, "max usage of "+formatBytes(b.MaxUsageBytes)+" nearly reached")
+		}
+	}
+	if b.TotalBytes > 0 {
+		if free < MinFreeBytes {
+			c.Full = true
+			c.Warnings = append(c.Warnings, "only "+formatBytes(b.FreeBytes)+" free")
+		} else if float64(free) <= (1-WarnUsageRatio)*float64(b.TotalBytes) {
+			c.Warnings = append(c.Warnings, "storage nearly full, "+formatBytes(b.FreeBytes)+" free")
+		}
+	}
+	return
+}
+
+// pendingBytes estimates the size of the queued downloads of the blobber.
+// Jobs with reported progress count their remaining bytes,
+// other jobs the average size of the stored blobs of their type.
+func pendingBytes(db *gorm.DB, blobberID uint) (n int64, err error) {
+	jobs := db.Model(&common.Queue{}).Where(&common.Queue{BlobberID: blobberID, Action: common.GetBlob})
+	if err = jobs.Session(&gorm.Session{}).
+		Where("bytes_total > 0").
+		Select("COALESCE(SUM(bytes_total - bytes_done), 0)").
+		Scan(&n).Error; err != nil {
+		return
+	}
+
+	var unreported []struct {
+		Type common.BlobType
+		Jobs int64
+	}
+	if err = jobs.Session(&gorm.Session{}).
+		Where("bytes_total <= 0").
+		Select("type, COUNT(*) AS jobs").
+		Group("type").
+		Scan(&unreported).Error; err != nil {
+		return
+	}
+	for _, u := range unreported {
+		var avg float64
+		if err = db.Model(&common.BlobLocation{}).
+			Where("type = ? AND size > 0", u.Type).
+			Select("COALESCE(AVG(size), 0)").
+			Scan(&avg).Error; err != nil {
+			return
+		}
+		if avg <= 0 {
+			avg = DefaultBlobBytes
+		}
+		n += int64(avg) * u.Jobs
+	}
+	return
+}
+
+// checkCapacity returns a BlobberFullError if the blobber can't receive downloads
+func checkCapacity(db *gorm.DB, blobberID uint) (err error) {
+	var blobbers []*common.BlobDownloader
+	if err = db.Where(&common.BlobDownloader{ID: blobberID}).Limit(1).Find(&blobbers).Error; err != nil || len(blobbers) == 0 {
+		return
+	}
+	b := blobbers[0]
+	var c *Capacity
+	if c, err = BlobberCapacity(db, b); err != nil || !c.Full {
+		return
+	}
+	return &common.BlobberFullError{BlobberID: blobberID, Reason: c.Warnings[0]}
+}
+
+// formatBytes formats n with a binary unit, e.g. 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "iB"
+}
@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBlobberCapacity(t *testing.T) {
+	db := openDB(t)
+	b := &common.BlobDownloader{Name: "blobby", Secret: "secret", MaxUsageBytes: 1000}
+	assert.NoError(t, db.Create(b).Error)
+	assert.NoError(t, db.Create(&common.BlobLocation{VideoID: "a", BlobDownloaderID: b.ID, Path: "a",
+		AddedAt: time.Now(), Type: common.VideoBlobType, Size: 950}).Error)
+
+	c, err := BlobberCapacity(db, b)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(950), c.UsedBytes)
+	assert.False(t, c.Full)
+	assert.Equal(t, []string{"max usage of 1000 B nearly reached"}, c.Warnings)
+
+	_, err = Enqueue(db, &common.Queue{VideoID: "b", BlobberID: b.ID, Action: common.GetBlob, Type: common.VideoBlobType})
+	assert.NoError(t, err)
+
+	// reported free space below the minimum
+	b.TotalBytes, b.FreeBytes = 100<<30, 1<<20
+	assert.NoError(t, db.Save(b).Error)
+	_, err = Enqueue(db, &common.Queue{VideoID: "c", BlobberID: b.ID, Action: common.GetBlob, Type: common.VideoBlobType})
+	assert.ErrorIs(t, err, common.ErrBlobberFull)
+
+	// removals are always queued
+	created, err := Enqueue(db, &common.Queue{VideoID: "a", BlobberID: b.ID, Action: common.RemoveBlob, Type: common.VideoBlobType})
+	assert.NoError(t, err)
+	assert.True(t, created)
+}
+
+func TestPendingBytes(t *testing.T) {
+	db := openDB(t)
+	empty := &common.BlobDownloader{Name: "empty", Secret: "secret", MaxUsageBytes: 1000}
+	other := &common.BlobDownloader{Name: "other", Secret: "secret"}
+	assert.NoError(t, db.Create([]*common.BlobDownloader{empty, other}).Error)
+	assert.NoError(t, db.Create(&common.BlobLocation{VideoID: "a", BlobDownloaderID: other.ID, Path: "a",
+		AddedAt: time.Now(), Type: common.VideoBlobType, Size: 400}).Error)
+
+	// queued downloads are estimated by the average size of stored blobs
+	for _, id := range []string{"b", "c", "d"} {
+		_, err := Enqueue(db, &common.Queue{VideoID: id, BlobberID: empty.ID, Action: common.GetBlob, Type: common.VideoBlobType})
+		assert.NoError(t, err)
+	}
+	_, err := Enqueue(db, &common.Queue{VideoID: "e", BlobberID: empty.ID, Action: common.GetBlob, Type: common.VideoBlobType})
+	assert.ErrorIs(t, err, common.ErrBlobberFull)
+
+	c, err := BlobberCapacity(db, empty)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), c.UsedBytes)
+	assert.Equal(t, int64(1200), c.PendingBytes)
+	assert.True(t, c.Full)
+
+	// reported progress replaces the estimate
+	assert.NoError(t, db.Model(&common.Queue{}).Where("video_id = ?", "b").
+		Updates(map[string]interface{}{"bytes_total": 100, "bytes_done": 40}).Error)
+	n, err := pendingBytes(db, empty.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(860), n)
+
+	// types without stored blobs use the default estimate
+	n, err = pendingBytes(db, other.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.NoError(t, db.Create(&common.Queue{VideoID: "b", BlobberID: other.ID, Action: common.GetBlob, Type: common.CaptionBlobType}).Error)
+	n, err = pendingBytes(db, other.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(DefaultBlobBytes), n)
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "10.0 GiB", formatBytes(10<<30))
+}
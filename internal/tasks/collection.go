@@ -0,0 +1,36 @@
+package tasks
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"gorm.io/gorm"
+)
+
+// AssignBlobber adds the blobber to the video and queues the download of the video.
+// Nothing is queued if the blobber already stores the video or if the blobber is full.
+func AssignBlobber(db *gorm.DB, v *common.Video, b *common.BlobDownloader) (queued bool, err error) {
+	if err = db.Model(v).Omit("Blobbers.*").Association("Blobbers").Append(b); err != nil {
+		return
+	}
+
+	var stored int64
+	if err = db.Model(&common.BlobLocation{}).Where(&common.BlobLocation{
+		VideoID:          v.ID,
+		BlobDownloaderID: b.ID,
+		Type:             common.VideoBlobType,
+	}).Count(&stored).Error; err != nil || stored > 0 {
+		return
+	}
+
+	if queued, err = Enqueue(db, &common.Queue{
+		VideoID:   v.ID,
+		BlobberID: b.ID,
+		Action:    common.GetBlob,
+		Type:      common.VideoBlobType,
+	}); errors.Is(err, common.ErrBlobberFull) {
+		log.WithError(err).Warnf("Not queueing video %s", v.ID)
+		return false, nil
+	}
+	return
+}
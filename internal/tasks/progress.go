@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DefaultStaleProgress is the time without progress after which a job is released
+const DefaultStaleProgress = 15 * time.Minute
+
+// ReleaseStaleJobs releases all jobs whose last progress is older than threshold.
+// Released jobs lose their acknowledgement and progress, so they are pushed to the blobber again.
+func ReleaseStaleJobs(db *gorm.DB, threshold time.Duration) (released int, err error) {
+	var stale []*common.Queue
+	if err = db.Where("progress_at < ?", time.Now().Add(-threshold)).Find(&stale).Error; err != nil {
+		return
+	}
+	for _, q := range stale {
+		if err = db.Model(&common.Queue{}).Where(&common.Queue{
+			VideoID:   q.VideoID,
+			BlobberID: q.BlobberID,
+			Action:    q.Action,
+			Type:      q.Type,
+		}).Updates(map[string]interface{}{
+			"acked_at":    sql.NullTime{},
+			"stage":       "",
+			"bytes_done":  0,
+			"bytes_total": 0,
+			"eta":         0,
+			"progress_at": sql.NullTime{},
+		}).Error; err != nil {
+			return
+		}
+		released++
+		events.Publish(events.QueueReleased, q.VideoID, events.QueueJob{
+			BlobberID: q.BlobberID,
+			Action:    q.Action.String(),
+			Type:      q.Type.String(),
+		})
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReleaseStaleJobs(t *testing.T) {
+	db := openDB(t)
+	now := time.Now()
+
+	acked := sql.NullTime{Valid: true, Time: now.Add(-time.Hour)}
+	assert.NoError(t, db.Create([]*common.Queue{
+		// stale
+		{VideoID: "a", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType, AckedAt: acked,
+			Stage: "downloading", BytesDone: 10, BytesTotal: 100, ETA: 60,
+			ProgressAt: sql.NullTime{Valid: true, Time: now.Add(-time.Hour)}},
+		// recent progress
+		{VideoID: "b", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType, AckedAt: acked,
+			BytesDone: 10, ProgressAt: sql.NullTime{Valid: true, Time: now}},
+		// no progress yet
+		{VideoID: "c", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType, AckedAt: acked},
+	}).Error)
+
+	released, err := ReleaseStaleJobs(db, DefaultStaleProgress)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	var queue []*common.Queue
+	assert.NoError(t, db.Order("video_id").Find(&queue).Error)
+	if assert.Len(t, queue, 3) {
+		assert.False(t, queue[0].AckedAt.Valid)
+		assert.False(t, queue[0].ProgressAt.Valid)
+		assert.Equal(t, int64(0), queue[0].BytesDone)
+		assert.Empty(t, queue[0].Stage)
+
+		assert.True(t, queue[1].ProgressAt.Valid)
+		assert.True(t, queue[2].AckedAt.Valid)
+	}
+}
@@ -0,0 +1,85 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"gorm.io/gorm"
+)
+
+// PurgeVideo permanently deletes the video (including disabled videos) and all of its dependent rows.
+// Every blobber which stores a blob of the video gets a RemoveBlob job, queued downloads and verifications are dropped.
+// removals is the number of queued RemoveBlob jobs.
+func PurgeVideo(db *gorm.DB, videoID string) (removals int, err error) {
+	err = Transaction(db, func(tx *gorm.DB) (err error) {
+		v := &common.Video{ID: videoID}
+		if err = tx.Unscoped().Where(v).First(v).Error; err != nil {
+			return
+		}
+
+		// remove stored blobs from blobbers
+		var stored []*common.BlobLocation
+		if err = tx.Where(&common.BlobLocation{VideoID: videoID}).
+			Distinct("blob_downloader_id", "type").
+			Find(&stored).Error; err != nil {
+			return
+		}
+		for _, l := range stored {
+			var created bool
+			if created, err = Enqueue(tx, &common.Queue{
+				VideoID:   videoID,
+				BlobberID: l.BlobDownloaderID,
+				Action:    common.RemoveBlob,
+				Type:      l.Type,
+			}); err != nil {
+				return
+			}
+			if created {
+				removals++
+			}
+		}
+		// downloads and verifications are dropped, only the removals are kept
+		if err = tx.Where("video_id = ? AND action <> ?", videoID, common.RemoveBlob).
+			Delete(&common.Queue{}).Error; err != nil {
+			return
+		}
+
+		// comments
+		if err = tx.Where("comment_id IN (?)", tx.Model(&common.Comment{}).
+			Select("id").
+			Where(&common.Comment{VideoID: videoID})).
+			Delete(&common.CommentHistory{}).Error; err != nil {
+			return
+		}
+
+		// rows which reference the video
+		for _, model := range []interface{}{
+			&common.BlobLocation{},
+			&common.VideoHistory{},
+			&common.VideoViewCountHistory{},
+			&common.VideoLikeCountHistory{},
+			&common.VideoCommentCountHistory{},
+			&common.VideoSnapshot{},
+			&common.Comment{},
+			&common.CommentThread{},
+			&common.Caption{},
+		} {
+			if err = tx.Where("video_id = ?", videoID).Delete(model).Error; err != nil {
+				return
+			}
+		}
+
+		// snapshot blobs are shared by their hash, so only delete unreferenced blobs
+		if err = tx.Where("hash NOT IN (?)", tx.Model(&common.VideoSnapshot{}).Select("hash")).
+			Delete(&common.SnapshotBlob{}).Error; err != nil {
+			return
+		}
+
+		if err = tx.Model(v).Association("Blobbers").Clear(); err != nil {
+			return
+		}
+		if err = tx.Model(v).Association("Collections").Clear(); err != nil {
+			return
+		}
+		return tx.Unscoped().Delete(v).Error
+	})
+	return
+}
@@ -0,0 +1,67 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestPurgeVideo(t *testing.T) {
+	db := openDB(t)
+	now := time.Now()
+
+	blobbers := []*common.BlobDownloader{{Name: "a", Secret: "a"}, {Name: "b", Secret: "b"}}
+	assert.NoError(t, db.Create(blobbers).Error)
+	assert.NoError(t, db.Create(&common.Video{ID: "a", Blobbers: blobbers}).Error)
+	assert.NoError(t, db.Create(&common.Video{ID: "b", Blobbers: blobbers}).Error)
+
+	for _, id := range []string{"a", "b"} {
+		assert.NoError(t, db.Create(&common.BlobLocation{VideoID: id, BlobDownloaderID: 1, Path: id, AddedAt: now, Type: common.VideoBlobType}).Error)
+		assert.NoError(t, db.Create(&common.VideoHistory{VideoID: id, Field: "title", UpdatedAt: now}).Error)
+		_, err := SaveSnapshot(db, id, &youtube.Video{Snippet: &youtube.VideoSnippet{Title: "same"}}, now)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, db.Create(&common.BlobLocation{VideoID: "a", BlobDownloaderID: 1, Path: "a.vtt", AddedAt: now, Type: common.CaptionBlobType}).Error)
+	assert.NoError(t, db.Create(&common.Queue{VideoID: "a", BlobberID: 2, Action: common.GetBlob, Type: common.VideoBlobType}).Error)
+	assert.NoError(t, db.Create(&common.Queue{VideoID: "a", BlobberID: 1, Action: common.VerifyBlob, Type: common.VideoBlobType}).Error)
+	assert.NoError(t, db.Create(&common.Comment{ID: "c", VideoID: "a", FirstSeen: now, LastSeen: now}).Error)
+	assert.NoError(t, db.Create(&common.CommentHistory{CommentID: "c", UpdatedAt: now}).Error)
+
+	// disabled videos can be purged as well
+	assert.NoError(t, db.Delete(&common.Video{ID: "a"}).Error)
+
+	removals, err := PurgeVideo(db, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removals)
+
+	var queue []*common.Queue
+	assert.NoError(t, db.Order("type").Find(&queue).Error)
+	if assert.Len(t, queue, 2) {
+		for _, q := range queue {
+			assert.Equal(t, common.RemoveBlob, q.Action)
+			assert.Equal(t, uint(1), q.BlobberID)
+		}
+		assert.Equal(t, common.CaptionBlobType, queue[1].Type)
+	}
+
+	count := func(model interface{}) (n int64) {
+		assert.NoError(t, db.Model(model).Count(&n).Error)
+		return
+	}
+	assert.Equal(t, int64(1), count(&common.BlobLocation{}))
+	assert.Equal(t, int64(1), count(&common.VideoHistory{}))
+	assert.Equal(t, int64(1), count(&common.VideoSnapshot{}))
+	assert.Equal(t, int64(0), count(&common.Comment{}))
+	assert.Equal(t, int64(0), count(&common.CommentHistory{}))
+	// the snapshot blob of b is identical and must be kept
+	assert.Equal(t, int64(1), count(&common.SnapshotBlob{}))
+	assert.Equal(t, int64(2), db.Model(&common.Video{ID: "b"}).Association("Blobbers").Count())
+	assert.Equal(t, int64(0), db.Model(&common.Video{ID: "a"}).Association("Blobbers").Count())
+	assert.ErrorIs(t, db.Unscoped().First(&common.Video{}, "id = ?", "a").Error, gorm.ErrRecordNotFound)
+
+	_, err = PurgeVideo(db, "a")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Enqueue adds the job to the queue if it isn't queued already.
+// created is false if the job was already in the queue.
+// Downloads for full blobbers are rejected with a BlobberFullError.
+// Jobs enqueued within Transaction are announced after the commit, use it for jobs which might be rolled back.
+func Enqueue(db *gorm.DB, q *common.Queue) (created bool, err error) {
+	if q.Action == common.GetBlob {
+		if err = checkCapacity(db, q.BlobberID); err != nil {
+			return
+		}
+	}
+	tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(q)
+	if err = tx.Error; err != nil {
+		return
+	}
+	if created = tx.RowsAffected > 0; created {
+		publishQueued(db, q)
+	}
+	return
+}
+
+type pendingJobsKey struct{}
+
+// Transaction runs fn in a transaction and publishes the QueueEnqueued events of the jobs enqueued by fn
+// once the transaction was committed, jobs of a rolled back transaction are never announced.
+// Nested calls are published by the outermost call.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	if _, ok := db.Statement.Context.Value(pendingJobsKey{}).(*[]*common.Queue); ok {
+		return db.Transaction(fn)
+	}
+	var pending []*common.Queue
+	ctx := context.WithValue(db.Statement.Context, pendingJobsKey{}, &pending)
+	if err = db.WithContext(ctx).Transaction(fn); err != nil {
+		return
+	}
+	for _, q := range pending {
+		publishQueued(db, q)
+	}
+	return
+}
+
+// publishQueued publishes the QueueEnqueued event of the job,
+// the event is deferred until the commit if db belongs to a Transaction
+func publishQueued(db *gorm.DB, q *common.Queue) {
+	if pending, ok := db.Statement.Context.Value(pendingJobsKey{}).(*[]*common.Queue); ok {
+		*pending = append(*pending, q)
+		return
+	}
+	events.Publish(events.QueueEnqueued, q.VideoID, events.QueueJob{
+		BlobberID: q.BlobberID,
+		Action:    q.Action.String(),
+		Type:      q.Type.String(),
+	})
+}
+
+// EnqueueDownload adds the video to the download queue of all of its blobbers
+func EnqueueDownload(db *gorm.DB, v *common.Video) (err error) {
+	return EnqueueBlob(db, v, common.VideoBlobType)
+}
+
+// EnqueueBlob adds a blob of the video to the download queue of all of its blobbers,
+// full blobbers are skipped
+func EnqueueBlob(db *gorm.DB, v *common.Video, typ common.BlobType) (err error) {
+	// fetch all blobbers for the video
+	if err = db.Preload("Blobbers").Where(v).First(v).Error; err != nil {
+		return
+	}
+	// add video to queue
+	for _, b := range v.Blobbers {
+		log.Infof("Adding %s of video %s to blobber-queue %d", typ, v.ID, b.ID)
+		if _, err = Enqueue(db, &common.Queue{
+			VideoID:   v.ID,
+			BlobberID: b.ID,
+			Action:    common.GetBlob,
+			Type:      typ,
+		}); errors.Is(err, common.ErrBlobberFull) {
+			log.WithError(err).Warnf("Skipping %s of video %s", typ, v.ID)
+			err = nil
+		} else if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	db := openDB(t)
+	assert.NoError(t, db.Create(&common.BlobDownloader{Name: "a", Secret: "a"}).Error)
+	assert.NoError(t, db.Create(&common.Video{ID: "tx"}).Error)
+
+	evs, cancel := events.Subscribe(8)
+	defer cancel()
+	enqueued := func() (n int) {
+		for {
+			select {
+			case e := <-evs:
+				if e.Type == events.QueueEnqueued && e.VideoID == "tx" {
+					n++
+				}
+			default:
+				return
+			}
+		}
+	}
+	job := func(action common.QueueAction) *common.Queue {
+		return &common.Queue{VideoID: "tx", BlobberID: 1, Action: action, Type: common.VideoBlobType}
+	}
+
+	// jobs of rolled back transactions are never announced
+	errRollback := errors.New("rollback")
+	assert.ErrorIs(t, Transaction(db, func(tx *gorm.DB) (err error) {
+		if _, err = Enqueue(tx, job(common.GetBlob)); err != nil {
+			return
+		}
+		return errRollback
+	}), errRollback)
+	assert.Equal(t, 0, enqueued())
+
+	// jobs are announced after the commit, including jobs of nested transactions
+	assert.NoError(t, Transaction(db, func(tx *gorm.DB) (err error) {
+		if _, err = Enqueue(tx, job(common.GetBlob)); err != nil {
+			return
+		}
+		if err = Transaction(tx, func(tx *gorm.DB) (err error) {
+			_, err = Enqueue(tx, job(common.VerifyBlob))
+			return
+		}); err != nil {
+			return
+		}
+		assert.Equal(t, 0, enqueued())
+		return
+	}))
+	assert.Equal(t, 2, enqueued())
+
+	// jobs enqueued outside of a transaction are announced immediately
+	created, err := Enqueue(db, job(common.RemoveBlob))
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 1, enqueued())
+}
@@ -0,0 +1,48 @@
+package tasks
+
+import (
+	"github.com/ICBX/penguin/pkg/common"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	// DefaultScrubInterval is the time after which a stored blob is verified again
+	DefaultScrubInterval = 7 * 24 * time.Hour
+	// DefaultScrubBatch is the maximum number of blobs queued for verification per run
+	DefaultScrubBatch = 100
+)
+
+// EnqueueScrub queues VerifyBlob jobs for stored blobs which weren't verified within interval.
+// At most batch blobs are queued, so the verification of large archives is spread over multiple runs.
+func EnqueueScrub(db *gorm.DB, interval time.Duration, batch int) (queued int, err error) {
+	var stale []*common.BlobLocation
+	if err = db.
+		Where("verified_at IS NULL OR verified_at < ?", time.Now().Add(-interval)).
+		// blobs which are downloaded right now are verified with the next run
+		Where("NOT EXISTS (?)", db.Model(&common.Queue{}).
+			Select("1").
+			Where("queues.video_id = blob_locations.video_id").
+			Where("queues.blobber_id = blob_locations.blob_downloader_id").
+			Where("queues.type = blob_locations.type")).
+		Order("verified_at, added_at").
+		Limit(batch).
+		Find(&stale).Error; err != nil {
+		return
+	}
+	for _, l := range stale {
+		var created bool
+		if created, err = Enqueue(db, &common.Queue{
+			VideoID:   l.VideoID,
+			BlobberID: l.BlobDownloaderID,
+			Action:    common.VerifyBlob,
+			Type:      l.Type,
+		}); err != nil {
+			return
+		}
+		if created {
+			queued++
+		}
+	}
+	return
+}
@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEnqueueScrub(t *testing.T) {
+	db := openDB(t)
+	now := time.Now()
+
+	assert.NoError(t, db.Create([]*common.BlobLocation{
+		// never verified
+		{VideoID: "a", BlobDownloaderID: 1, Type: common.VideoBlobType, Path: "a", AddedAt: now},
+		// verified long ago
+		{VideoID: "b", BlobDownloaderID: 1, Type: common.VideoBlobType, Path: "b", AddedAt: now,
+			VerifiedAt: sql.NullTime{Valid: true, Time: now.Add(-30 * 24 * time.Hour)}},
+		// verified recently
+		{VideoID: "c", BlobDownloaderID: 1, Type: common.VideoBlobType, Path: "c", AddedAt: now,
+			VerifiedAt: sql.NullTime{Valid: true, Time: now}},
+		// downloaded again right now
+		{VideoID: "d", BlobDownloaderID: 1, Type: common.VideoBlobType, Path: "d", AddedAt: now},
+	}).Error)
+	assert.NoError(t, db.Create(&common.Queue{VideoID: "d", BlobberID: 1, Action: common.GetBlob, Type: common.VideoBlobType}).Error)
+
+	queued, err := EnqueueScrub(db, DefaultScrubInterval, DefaultScrubBatch)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, queued)
+
+	var queue []*common.Queue
+	assert.NoError(t, db.Where(&common.Queue{Action: common.VerifyBlob}).Order("video_id").Find(&queue).Error)
+	if assert.Len(t, queue, 2) {
+		assert.Equal(t, "a", queue[0].VideoID)
+		assert.Equal(t, "b", queue[1].VideoID)
+	}
+
+	// queued verifications aren't queued again
+	queued, err = EnqueueScrub(db, DefaultScrubInterval, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, queued)
+}
@@ -0,0 +1,93 @@
+package tasks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/ICBX/penguin/pkg/common"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"time"
+)
+
+// SaveSnapshot stores the API response of the video if it differs from the latest snapshot.
+// The ETag is stripped from the snapshot since it changes on every refresh,
+// the rest of the response (including the statistics) is kept.
+func SaveSnapshot(db *gorm.DB, videoID string, r *youtube.Video, t time.Time) (created bool, err error) {
+	stripped := *r
+	stripped.Etag = ""
+
+	var data []byte
+	if data, err = json.Marshal(&stripped); err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	// skip if nothing changed since the latest snapshot
+	var latest common.VideoSnapshot
+	if err = db.Where(&common.VideoSnapshot{VideoID: videoID}).Order("time DESC").First(&latest).Error; err == nil {
+		if latest.Hash == hash {
+			return false, nil
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err = zw.Write(data); err != nil {
+		return
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// blobs are content-addressed, so an existing blob has the same content
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&common.SnapshotBlob{
+			Hash: hash,
+			Data: compressed.Bytes(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&common.VideoSnapshot{
+			VideoID: videoID,
+			Hash:    hash,
+			Time:    t,
+		}).Error
+	})
+	return err == nil, err
+}
+
+// SnapshotAt returns the latest snapshot of the video taken at or before at
+// and its uncompressed JSON data
+func SnapshotAt(db *gorm.DB, videoID string, at time.Time) (snapshot *common.VideoSnapshot, data []byte, err error) {
+	snapshot = new(common.VideoSnapshot)
+	if err = db.Where(&common.VideoSnapshot{VideoID: videoID}).
+		Where("time <= ?", at).
+		Order("time DESC").
+		First(snapshot).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var blob common.SnapshotBlob
+	if err = db.Where(&common.SnapshotBlob{Hash: snapshot.Hash}).First(&blob).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var zr *gzip.Reader
+	if zr, err = gzip.NewReader(bytes.NewReader(blob.Data)); err != nil {
+		return nil, nil, err
+	}
+	defer zr.Close()
+	if data, err = io.ReadAll(zr); err != nil {
+		return nil, nil, err
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(common.TableModels...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSnapshot(t *testing.T) {
+	db := openDB(t)
+	t0 := time.Now().Add(-time.Hour)
+
+	v := &youtube.Video{
+		Id:         "hello",
+		Etag:       "a",
+		Snippet:    &youtube.VideoSnippet{Title: "Hello"},
+		Statistics: &youtube.VideoStatistics{ViewCount: 1},
+	}
+	created, err := SaveSnapshot(db, "hello", v, t0)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// a changed etag doesn't create a new snapshot
+	v.Etag = "b"
+	created, err = SaveSnapshot(db, "hello", v, t0.Add(30*time.Second))
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	// changed statistics do
+	v.Statistics.FavoriteCount = 2
+	created, err = SaveSnapshot(db, "hello", v, t0.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// changed title does
+	v.Snippet.Title = "World"
+	created, err = SaveSnapshot(db, "hello", v, t0.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// changing it back reuses the first blob
+	v.Snippet.Title = "Hello"
+	created, err = SaveSnapshot(db, "hello", v, t0.Add(3*time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	var blobs int64
+	assert.NoError(t, db.Model(&common.SnapshotBlob{}).Count(&blobs).Error)
+	assert.Equal(t, int64(3), blobs)
+
+	// snapshot at a point in time
+	snapshot, data, err := SnapshotAt(db, "hello", t0.Add(150*time.Second))
+	assert.NoError(t, err)
+	assert.True(t, snapshot.Time.Equal(t0.Add(2*time.Minute)))
+
+	var res youtube.Video
+	assert.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, "World", res.Snippet.Title)
+	assert.Equal(t, uint64(2), res.Statistics.FavoriteCount)
+
+	_, _, err = SnapshotAt(db, "hello", t0.Add(-time.Minute))
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
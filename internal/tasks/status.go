@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Status keeps track of the state of the meta updater cronjob
+// so it can be reported by the readiness endpoint
+type Status struct {
+	mu sync.RWMutex
+
+	running   bool
+	startedAt time.Time
+
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      error
+	lastAPIErr   error
+}
+
+// StatusSnapshot is a point-in-time copy of Status
+type StatusSnapshot struct {
+	Running      bool
+	StartedAt    time.Time
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastErr      error
+	LastAPIErr   error
+}
+
+func NewStatus() *Status {
+	return &Status{}
+}
+
+// Start marks the updater as running
+func (s *Status) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = true
+	s.startedAt = time.Now()
+}
+
+// Stop marks the updater as stopped
+func (s *Status) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = false
+}
+
+// Finish records a finished updater run which was started at start.
+// err is the last error returned by the run (nil if successful),
+// an *APIError is also kept separately because it means the YouTube API isn't reachable
+func (s *Status) Finish(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun = time.Now()
+	s.lastDuration = s.lastRun.Sub(start)
+	s.lastErr = err
+	s.lastAPIErr = nil
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		s.lastAPIErr = apiErr
+	}
+}
+
+func (s *Status) Snapshot() StatusSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return StatusSnapshot{
+		Running:      s.running,
+		StartedAt:    s.startedAt,
+		LastRun:      s.lastRun,
+		LastDuration: s.lastDuration,
+		LastErr:      s.lastErr,
+		LastAPIErr:   s.lastAPIErr,
+	}
+}
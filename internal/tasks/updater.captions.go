@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ICBX/penguin/internal/metrics"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DefaultCaptionsInterval is the default delay until the caption tracks of a video are listed again
+const DefaultCaptionsInterval = 7 * 24 * time.Hour
+
+// UpdateCaptions lists the caption tracks of videos whose captions were never listed,
+// whose caption state changed in the meta update since the last listing
+// or whose last listing is older than interval (0 only lists new and changed captions).
+// Listing captions is expensive (50 quota units per video, the default daily quota is 10,000),
+// edited tracks which don't change the caption state are only noticed after interval.
+func UpdateCaptions(ctx context.Context, service *youtube.Service, db *gorm.DB, interval time.Duration) (err error) {
+	changed := db.Model(&common.VideoHistory{}).Select("video_id").
+		Where("field = ? AND updated_at > videos.captions_updated", "captions")
+	query := db.Where("has_captions = ? AND captions_updated IS NULL", true).
+		Or("id IN (?)", changed)
+	if interval > 0 {
+		query = query.Or("has_captions = ? AND captions_updated < ?", true, time.Now().Add(-interval))
+	}
+
+	var videos []*common.Video
+	if err = query.Find(&videos).Error; err != nil {
+		return
+	}
+
+	log.Infof("[Captions] Listing captions of %d videos...", len(videos))
+	for _, v := range videos {
+		changed, cerr := updateCaptionsJob(ctx, service, db, v)
+		if cerr != nil {
+			log.WithError(cerr).Warnf("[Captions] [Video %s] cannot update captions", v.ID)
+			err = cerr
+			continue
+		}
+		if changed {
+			log.Infof("[Captions] [Video %s] captions changed, should be downloaded.", v.ID)
+			if err = EnqueueBlob(db, v, common.CaptionBlobType); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// updateCaptionsJob saves the caption tracks of the video and records changes in the video history.
+// changed is true if a track was added or updated.
+func updateCaptionsJob(ctx context.Context, service *youtube.Service, db *gorm.DB, v *common.Video) (changed bool, err error) {
+	var resp *youtube.CaptionListResponse
+	if resp, err = service.Captions.List([]string{"snippet"}, v.ID).Context(ctx).Do(); err != nil {
+		metrics.APIErrors.WithLabelValues(apiErrorReason(err)).Inc()
+		return
+	}
+
+	var known []*common.Caption
+	if err = db.Where(&common.Caption{VideoID: v.ID}).Find(&known).Error; err != nil {
+		return
+	}
+	byID := make(map[string]*common.Caption, len(known))
+	for _, c := range known {
+		byID[c.ID] = c
+	}
+
+	var (
+		t       = time.Now()
+		fetched = v.CaptionsUpdated.Valid
+		record  = func(c *common.Caption, old, new string) error {
+			if !fetched || old == new {
+				return nil
+			}
+			return db.Create(&common.VideoHistory{
+				VideoID:   v.ID,
+				Field:     "caption:" + c.ID,
+				Old:       old,
+				New:       new,
+				UpdatedAt: t,
+			}).Error
+		}
+	)
+
+	seen := make(map[string]bool)
+	for _, item := range resp.Items {
+		if item.Snippet == nil {
+			continue
+		}
+		seen[item.Id] = true
+
+		c := &common.Caption{
+			ID:        item.Id,
+			VideoID:   v.ID,
+			Language:  item.Snippet.Language,
+			Name:      item.Snippet.Name,
+			TrackKind: item.Snippet.TrackKind,
+		}
+		if lu, err := time.Parse(time.RFC3339, item.Snippet.LastUpdated); err == nil {
+			c.LastUpdated = sql.NullTime{Valid: true, Time: lu}
+		}
+
+		old, ok := byID[c.ID]
+		if ok && !old.DeletedSince.Valid && describeCaption(old) == describeCaption(c) {
+			continue
+		}
+		oldDesc := ""
+		if ok && !old.DeletedSince.Valid {
+			oldDesc = describeCaption(old)
+		}
+		if err = record(c, oldDesc, describeCaption(c)); err != nil {
+			return
+		}
+		// Save also clears DeletedSince of re-appeared tracks
+		if err = db.Save(c).Error; err != nil {
+			return
+		}
+		changed = true
+	}
+
+	// mark missing tracks as deleted
+	for _, c := range known {
+		if seen[c.ID] || c.DeletedSince.Valid {
+			continue
+		}
+		if err = record(c, describeCaption(c), ""); err != nil {
+			return
+		}
+		if err = db.Model(c).Update("deleted_since", sql.NullTime{Valid: true, Time: t}).Error; err != nil {
+			return
+		}
+	}
+
+	v.CaptionsUpdated = sql.NullTime{Valid: true, Time: t}
+	err = db.Model(v).Update("captions_updated", v.CaptionsUpdated).Error
+	return
+}
+
+// describeCaption returns the value of a caption track recorded in the video history
+func describeCaption(c *common.Caption) string {
+	var lastUpdated string
+	if c.LastUpdated.Valid {
+		lastUpdated = c.LastUpdated.Time.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%s (%s, %s) %s", c.Language, c.TrackKind, c.Name, lastUpdated)
+}
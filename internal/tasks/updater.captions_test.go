@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpdateCaptions(t *testing.T) {
+	db := openDB(t)
+
+	tracks := []*youtube.Caption{
+		{Id: "en", Snippet: &youtube.CaptionSnippet{Language: "en", TrackKind: "standard", LastUpdated: "2022-04-01T00:00:00Z"}},
+		{Id: "de", Snippet: &youtube.CaptionSnippet{Language: "de", TrackKind: "asr", LastUpdated: "2022-04-01T00:00:00Z"}},
+	}
+	var listed int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listed++
+		assert.Equal(t, "hello", r.URL.Query().Get("videoId"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(youtube.CaptionListResponse{Items: tracks})
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(t, err)
+
+	blobber := &common.BlobDownloader{Name: "blobby", Secret: "blobby"}
+	assert.NoError(t, db.Create(&common.Video{ID: "hello", HasCaptions: true, Blobbers: []*common.BlobDownloader{blobber}}).Error)
+	assert.NoError(t, db.Create(&common.Video{ID: "world"}).Error)
+
+	// initial listing enqueues captions without recording history
+	assert.NoError(t, UpdateCaptions(context.Background(), service, db, DefaultCaptionsInterval))
+	assert.Equal(t, 1, listed)
+
+	var queue []*common.Queue
+	assert.NoError(t, db.Find(&queue).Error)
+	if assert.Len(t, queue, 1) {
+		assert.Equal(t, common.CaptionBlobType, queue[0].Type)
+		assert.Equal(t, common.GetBlob, queue[0].Action)
+	}
+	var history []*common.VideoHistory
+	assert.NoError(t, db.Find(&history).Error)
+	assert.Len(t, history, 0)
+
+	// captions are only listed again after the interval
+	assert.NoError(t, db.Where("1 = 1").Delete(&common.Queue{}).Error)
+	assert.NoError(t, UpdateCaptions(context.Background(), service, db, DefaultCaptionsInterval))
+	assert.Equal(t, 1, listed)
+	assert.NoError(t, UpdateCaptions(context.Background(), service, db, time.Nanosecond))
+	assert.Equal(t, 2, listed)
+	assert.NoError(t, db.Find(&queue).Error)
+	assert.Len(t, queue, 0)
+
+	// updated and removed track after the caption state changed in the meta update
+	assert.NoError(t, db.Create(&common.VideoHistory{VideoID: "hello", Field: "captions", Old: "false", New: "true",
+		UpdatedAt: time.Now()}).Error)
+	tracks[0].Snippet.LastUpdated = "2022-04-02T00:00:00Z"
+	tracks = tracks[:1]
+	assert.NoError(t, UpdateCaptions(context.Background(), service, db, 0))
+	assert.Equal(t, 3, listed)
+
+	assert.NoError(t, db.Find(&queue).Error)
+	assert.Len(t, queue, 1)
+	assert.NoError(t, db.Where("field LIKE ?", "caption:%").Order("field").Find(&history).Error)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "caption:de", history[0].Field)
+		assert.Equal(t, "", history[0].New)
+		assert.Equal(t, "caption:en", history[1].Field)
+		assert.Contains(t, history[1].New, "2022-04-02")
+	}
+
+	var deleted common.Caption
+	assert.NoError(t, db.Where(&common.Caption{ID: "de"}).First(&deleted).Error)
+	assert.True(t, deleted.DeletedSince.Valid)
+
+	// the change was handled
+	assert.NoError(t, UpdateCaptions(context.Background(), service, db, 0))
+	assert.Equal(t, 3, listed)
+}
@@ -0,0 +1,195 @@
+package tasks
+
+import (
+	"database/sql"
+	"github.com/ICBX/penguin/internal/metrics"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// channelUpdateParts contains the requested parts for the
+// YouTube Data V3 API call
+var channelUpdateParts = []string{
+	"brandingSettings",
+	"id",
+	"snippet",
+	"statistics",
+}
+
+// channelBatchSize is the maximum number of ids per channels.list call
+const channelBatchSize = 50
+
+// UpdateChannels refreshes the meta data of the channels of all tracked videos
+func UpdateChannels(service *youtube.Service, db *gorm.DB) (err error) {
+	// create missing channels
+	var ids []string
+	if err = db.Model(&common.Video{}).Where("channel_id <> ''").Distinct().Pluck("channel_id", &ids).Error; err != nil {
+		return
+	}
+	for _, id := range ids {
+		if err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&common.Channel{ID: id}).Error; err != nil {
+			return
+		}
+	}
+
+	var channels []*common.Channel
+	if err = db.Find(&channels).Error; err != nil {
+		return
+	}
+
+	log.Infof("[Channels] Updating %d channels...", len(channels))
+	for start := 0; start < len(channels); start += channelBatchSize {
+		end := start + channelBatchSize
+		if end > len(channels) {
+			end = len(channels)
+		}
+		if berr := updateChannelBatch(service, db, channels[start:end]); berr != nil {
+			log.WithError(berr).Warn("[Channels] cannot update channels")
+			err = berr
+		}
+	}
+	return
+}
+
+func updateChannelBatch(service *youtube.Service, db *gorm.DB, channels []*common.Channel) (err error) {
+	ids := make([]string, len(channels))
+	byID := make(map[string]*common.Channel, len(channels))
+	for i, c := range channels {
+		ids[i] = c.ID
+		byID[c.ID] = c
+	}
+
+	var resp *youtube.ChannelListResponse
+	if resp, err = service.Channels.List(channelUpdateParts).Id(ids...).MaxResults(channelBatchSize).Do(); err != nil {
+		metrics.APIErrors.WithLabelValues(apiErrorReason(err)).Inc()
+		return
+	}
+
+	for _, r := range resp.Items {
+		c, ok := byID[r.Id]
+		if !ok {
+			continue
+		}
+		if err = updateChannelJob(db, c, r); err != nil {
+			return
+		}
+		delete(byID, r.Id)
+	}
+	for id := range byID {
+		log.Warnf("[Channels] [Channel %s] not returned by api, most likely terminated", id)
+	}
+	return
+}
+
+func updateChannelJob(db *gorm.DB, c *common.Channel, r *youtube.Channel) (err error) {
+	var (
+		t       = time.Now()
+		fetched = c.Fetched.Valid && c.Fetched.Bool
+		check   = func(old, new, field string) error {
+			if !fetched || old == new {
+				return nil
+			}
+			return db.Create(&common.ChannelHistory{
+				ChannelID: c.ID,
+				Field:     field,
+				Old:       old,
+				New:       new,
+				UpdatedAt: t,
+			}).Error
+		}
+	)
+
+	if sn := r.Snippet; sn != nil {
+		// title
+		if err = check(c.Title, sn.Title, "title"); err != nil {
+			return
+		}
+		c.Title = sn.Title
+
+		// description
+		if err = check(c.Description, sn.Description, "desc"); err != nil {
+			return
+		}
+		c.Description = sn.Description
+
+		// custom url
+		if err = check(c.CustomURL, sn.CustomUrl, "customUrl"); err != nil {
+			return
+		}
+		c.CustomURL = sn.CustomUrl
+
+		// avatar
+		if th := sn.Thumbnails; th != nil {
+			var avatar string
+			for _, d := range []*youtube.Thumbnail{th.High, th.Medium, th.Default} {
+				if d != nil && d.Url != "" {
+					avatar = d.Url
+					break
+				}
+			}
+			if err = check(c.AvatarURL, avatar, "avatar"); err != nil {
+				return
+			}
+			c.AvatarURL = avatar
+		}
+	}
+
+	// banner
+	if bs := r.BrandingSettings; bs != nil && bs.Image != nil {
+		if err = check(c.BannerURL, bs.Image.BannerExternalUrl, "banner"); err != nil {
+			return
+		}
+		c.BannerURL = bs.Image.BannerExternalUrl
+	}
+
+	// counts
+	if st := r.Statistics; st != nil {
+		c.HiddenSubscriberCount = st.HiddenSubscriberCount
+		if subs := st.SubscriberCount; subs != c.SubscriberCount && !st.HiddenSubscriberCount {
+			c.SubscriberCount = subs
+			if err = db.Create(&common.ChannelSubscriberCountHistory{
+				ChannelID:   c.ID,
+				Subscribers: subs,
+				Time:        t,
+			}).Error; err != nil {
+				return
+			}
+		}
+		if videos := st.VideoCount; videos != c.VideoCount {
+			c.VideoCount = videos
+			if err = db.Create(&common.ChannelVideoCountHistory{
+				ChannelID: c.ID,
+				Videos:    videos,
+				Time:      t,
+			}).Error; err != nil {
+				return
+			}
+		}
+		if views := st.ViewCount; views != c.ViewCount {
+			c.ViewCount = views
+			if err = db.Create(&common.ChannelViewCountHistory{
+				ChannelID: c.ID,
+				Views:     views,
+				Time:      t,
+			}).Error; err != nil {
+				return
+			}
+		}
+	}
+
+	// mark channel as fetched
+	c.Fetched = sql.NullBool{
+		Bool:  true,
+		Valid: true,
+	}
+
+	// update last updated timestamp
+	c.LastUpdated = sql.NullTime{Valid: true, Time: t}
+
+	// Save also writes fields which were cleared
+	return db.Save(c).Error
+}
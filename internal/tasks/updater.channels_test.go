@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdateChannels(t *testing.T) {
+	db := openDB(t)
+
+	channel := &youtube.Channel{
+		Id: "UC1",
+		Snippet: &youtube.ChannelSnippet{
+			Title:      "Penguins",
+			CustomUrl:  "penguins",
+			Thumbnails: &youtube.ThumbnailDetails{Default: &youtube.Thumbnail{Url: "avatar.jpg"}},
+		},
+		Statistics:       &youtube.ChannelStatistics{SubscriberCount: 10, VideoCount: 1, ViewCount: 100},
+		BrandingSettings: &youtube.ChannelBrandingSettings{Image: &youtube.ImageSettings{BannerExternalUrl: "banner.jpg"}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(youtube.ChannelListResponse{Items: []*youtube.Channel{channel}})
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Create(&common.Video{ID: "a", ChannelID: "UC1"}).Error)
+	assert.NoError(t, db.Create(&common.Video{ID: "b", ChannelID: "UC1"}).Error)
+
+	assert.NoError(t, UpdateChannels(service, db))
+
+	var c common.Channel
+	assert.NoError(t, db.First(&c).Error)
+	assert.Equal(t, "Penguins", c.Title)
+	assert.Equal(t, "avatar.jpg", c.AvatarURL)
+	assert.Equal(t, "banner.jpg", c.BannerURL)
+	assert.Equal(t, uint64(10), c.SubscriberCount)
+	assert.True(t, c.Fetched.Bool)
+
+	// changes are recorded after the initial fetch
+	channel.Snippet.Title = "More Penguins"
+	channel.Statistics.SubscriberCount = 20
+	assert.NoError(t, UpdateChannels(service, db))
+
+	var history []*common.ChannelHistory
+	assert.NoError(t, db.Find(&history).Error)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "title", history[0].Field)
+		assert.Equal(t, "More Penguins", history[0].New)
+	}
+
+	var subs []*common.ChannelSubscriberCountHistory
+	assert.NoError(t, db.Find(&subs).Error)
+	assert.Len(t, subs, 2)
+}
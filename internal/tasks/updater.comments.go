@@ -0,0 +1,178 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ICBX/penguin/internal/metrics"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/gorm"
+	"time"
+)
+
+// commentPageSize is the maximum page size allowed by the YouTube Data API
+const commentPageSize = 100
+
+// UpdateComments archives the comments of all videos with enabled comment archiving
+func UpdateComments(ctx context.Context, service *youtube.Service, db *gorm.DB) (err error) {
+	var videos []*common.Video
+	if err = db.Where("archive_comments = ?", true).Find(&videos).Error; err != nil {
+		return
+	}
+
+	log.Infof("[Comments] Archiving comments of %d videos...", len(videos))
+	for _, v := range videos {
+		if cerr := ArchiveComments(ctx, service, db, v); cerr != nil {
+			log.WithError(cerr).Warnf("[Comments] [Video %s] cannot archive comments", v.ID)
+			err = cerr
+		}
+	}
+	return
+}
+
+// ArchiveComments fetches all comment threads and replies of the video.
+// Edited comments are recorded in the comment history,
+// comments which are missing from the response are marked as deleted.
+func ArchiveComments(ctx context.Context, service *youtube.Service, db *gorm.DB, v *common.Video) (err error) {
+	var (
+		t    = time.Now()
+		seen = make(map[string]bool)
+	)
+
+	call := service.CommentThreads.List([]string{"snippet", "replies"}).
+		VideoId(v.ID).
+		MaxResults(commentPageSize).
+		TextFormat("plainText")
+	if err = call.Pages(ctx, func(resp *youtube.CommentThreadListResponse) error {
+		for _, thread := range resp.Items {
+			if err := archiveThread(ctx, service, db, v, thread, t, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		metrics.APIErrors.WithLabelValues(apiErrorReason(err)).Inc()
+		return
+	}
+
+	// mark comments which are gone as deleted
+	var known []*common.Comment
+	if err = db.Where(&common.Comment{VideoID: v.ID}).Where("deleted_since IS NULL").Find(&known).Error; err != nil {
+		return
+	}
+	for _, c := range known {
+		if seen[c.ID] {
+			continue
+		}
+		log.Infof("[Comments] [Video %s] comment %s was deleted", v.ID, c.ID)
+		if err = db.Model(c).Update("deleted_since", sql.NullTime{Valid: true, Time: t}).Error; err != nil {
+			return
+		}
+	}
+	return
+}
+
+func archiveThread(
+	ctx context.Context,
+	service *youtube.Service,
+	db *gorm.DB,
+	v *common.Video,
+	thread *youtube.CommentThread,
+	t time.Time,
+	seen map[string]bool,
+) (err error) {
+	if thread.Snippet == nil || thread.Snippet.TopLevelComment == nil {
+		return
+	}
+	if err = db.Save(&common.CommentThread{
+		ID:              thread.Id,
+		VideoID:         v.ID,
+		TotalReplyCount: uint64(thread.Snippet.TotalReplyCount),
+	}).Error; err != nil {
+		return
+	}
+	if err = saveComment(db, v.ID, thread.Id, thread.Snippet.TopLevelComment, t, seen); err != nil {
+		return
+	}
+
+	// the thread only contains a subset of the replies,
+	// so fetch them separately if there are more
+	var replies []*youtube.Comment
+	if thread.Replies != nil {
+		replies = thread.Replies.Comments
+	}
+	if thread.Snippet.TotalReplyCount > int64(len(replies)) {
+		replies = nil
+		if err = service.Comments.List([]string{"snippet"}).
+			ParentId(thread.Id).
+			MaxResults(commentPageSize).
+			TextFormat("plainText").
+			Pages(ctx, func(resp *youtube.CommentListResponse) error {
+				replies = append(replies, resp.Items...)
+				return nil
+			}); err != nil {
+			return
+		}
+	}
+	for _, reply := range replies {
+		if err = saveComment(db, v.ID, thread.Id, reply, t, seen); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func saveComment(db *gorm.DB, videoID, threadID string, c *youtube.Comment, t time.Time, seen map[string]bool) (err error) {
+	if c.Snippet == nil {
+		return
+	}
+	seen[c.Id] = true
+
+	comment := &common.Comment{
+		ID:                c.Id,
+		ThreadID:          threadID,
+		VideoID:           videoID,
+		ParentID:          c.Snippet.ParentId,
+		AuthorDisplayName: c.Snippet.AuthorDisplayName,
+		Text:              c.Snippet.TextOriginal,
+		LikeCount:         uint64(c.Snippet.LikeCount),
+		FirstSeen:         t,
+		LastSeen:          t,
+	}
+	if c.Snippet.AuthorChannelId != nil {
+		comment.AuthorChannelID = c.Snippet.AuthorChannelId.Value
+	}
+	if pa, err := time.Parse(time.RFC3339, c.Snippet.PublishedAt); err == nil {
+		comment.PublishedAt = sql.NullTime{Valid: true, Time: pa}
+	}
+	if c.Snippet.UpdatedAt != c.Snippet.PublishedAt {
+		if ua, err := time.Parse(time.RFC3339, c.Snippet.UpdatedAt); err == nil {
+			comment.EditedAt = sql.NullTime{Valid: true, Time: ua}
+		}
+	}
+
+	var existing common.Comment
+	if err = db.Where(&common.Comment{ID: c.Id}).First(&existing).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.Create(comment).Error
+		}
+		return
+	}
+
+	// record edited text
+	if existing.Text != comment.Text {
+		if err = db.Create(&common.CommentHistory{
+			CommentID: c.Id,
+			Old:       existing.Text,
+			New:       comment.Text,
+			UpdatedAt: t,
+		}).Error; err != nil {
+			return
+		}
+	}
+
+	comment.FirstSeen = existing.FirstSeen
+	return db.Model(&existing).Select("*").Updates(comment).Error
+}
@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func comment(id, parent, text string) *youtube.Comment {
+	return &youtube.Comment{
+		Id: id,
+		Snippet: &youtube.CommentSnippet{
+			ParentId:     parent,
+			TextOriginal: text,
+			PublishedAt:  "2022-04-01T00:00:00Z",
+			UpdatedAt:    "2022-04-01T00:00:00Z",
+		},
+	}
+}
+
+func TestArchiveComments(t *testing.T) {
+	db := openDB(t)
+
+	// thread a has 2 replies, but only 1 is embedded in the thread response
+	threads := []*youtube.CommentThread{
+		{Id: "a", Snippet: &youtube.CommentThreadSnippet{TopLevelComment: comment("a", "", "first"), TotalReplyCount: 2},
+			Replies: &youtube.CommentThreadReplies{Comments: []*youtube.Comment{comment("a.1", "a", "reply")}}},
+		{Id: "b", Snippet: &youtube.CommentThreadSnippet{TopLevelComment: comment("b", "", "second")}},
+	}
+	replies := []*youtube.Comment{comment("a.1", "a", "reply"), comment("a.2", "a", "another reply")}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/commentThreads"):
+			// first page contains thread a, second page thread b
+			if r.URL.Query().Get("pageToken") == "" {
+				_ = json.NewEncoder(w).Encode(youtube.CommentThreadListResponse{Items: threads[:1], NextPageToken: "next"})
+			} else {
+				_ = json.NewEncoder(w).Encode(youtube.CommentThreadListResponse{Items: threads[1:]})
+			}
+		case strings.HasSuffix(r.URL.Path, "/comments"):
+			assert.Equal(t, "a", r.URL.Query().Get("parentId"))
+			_ = json.NewEncoder(w).Encode(youtube.CommentListResponse{Items: replies})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(t, err)
+
+	video := &common.Video{ID: "hello", ArchiveComments: true}
+	assert.NoError(t, db.Create(video).Error)
+
+	assert.NoError(t, UpdateComments(context.Background(), service, db))
+
+	var comments []*common.Comment
+	assert.NoError(t, db.Order("id").Find(&comments).Error)
+	if assert.Len(t, comments, 4) {
+		assert.Equal(t, "a.2", comments[2].ID)
+		assert.Equal(t, "a", comments[2].ParentID)
+	}
+
+	// edit comment a, delete thread b
+	threads[0].Snippet.TopLevelComment.Snippet.TextOriginal = "first (edited)"
+	threads = threads[:1]
+	assert.NoError(t, ArchiveComments(context.Background(), service, db, video))
+
+	var history []*common.CommentHistory
+	assert.NoError(t, db.Find(&history).Error)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "a", history[0].CommentID)
+		assert.Equal(t, "first", history[0].Old)
+		assert.Equal(t, "first (edited)", history[0].New)
+	}
+
+	var deleted common.Comment
+	assert.NoError(t, db.Where(&common.Comment{ID: "b"}).First(&deleted).Error)
+	assert.True(t, deleted.DeletedSince.Valid)
+
+	var edited common.Comment
+	assert.NoError(t, db.Where(&common.Comment{ID: "a"}).First(&edited).Error)
+	assert.False(t, edited.DeletedSince.Valid)
+	assert.Equal(t, "first (edited)", edited.Text)
+}
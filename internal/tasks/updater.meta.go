@@ -2,8 +2,12 @@ package tasks
 
 import (
 	"database/sql"
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/internal/metrics"
 	"github.com/ICBX/penguin/pkg/common"
 	"github.com/apex/log"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/youtube/v3"
 	"gorm.io/gorm"
 	"strconv"
@@ -16,18 +20,31 @@ import (
 var metaUpdateParts = []string{
 	"contentDetails",
 	"id",
+	"liveStreamingDetails",
+	"localizations",
+	"player",
+	"recordingDetails",
 	"snippet",
 	"statistics",
 	"status",
+	"topicDetails",
 }
 
 const (
 	WorkerCount = 8
 )
 
+type updateResult struct {
+	video *common.Video
+	dl    bool
+	err   error
+}
+
+// UpdateVideos refreshes the meta data of all videos and returns the videos which should be downloaded.
+// err contains the last error which occurred while updating a video, preferring an *APIError
 func UpdateVideos(service *youtube.Service, db *gorm.DB, videos []*common.Video) (dl []*common.Video, err error) {
 	jobsChan := make(chan *common.Video, len(videos))
-	resChan := make(chan *common.Video, len(videos))
+	resChan := make(chan updateResult, len(videos))
 	for i := 0; i < WorkerCount; i++ {
 		go updateWorker(i, jobsChan, resChan, service, db)
 	}
@@ -41,8 +58,12 @@ func UpdateVideos(service *youtube.Service, db *gorm.DB, videos []*common.Video)
 	// await results and save them to the dl array
 	for i := 0; i < len(videos); i++ {
 		res := <-resChan
-		if res != nil {
-			dl = append(dl, res)
+		// errors of the YouTube API aren't replaced by other errors
+		if res.err != nil && !errors.As(err, new(*APIError)) {
+			err = res.err
+		}
+		if res.dl {
+			dl = append(dl, res.video)
 		}
 	}
 	close(resChan)
@@ -50,7 +71,7 @@ func UpdateVideos(service *youtube.Service, db *gorm.DB, videos []*common.Video)
 	return
 }
 
-func updateWorker(i int, in, out chan *common.Video, service *youtube.Service, db *gorm.DB) {
+func updateWorker(i int, in chan *common.Video, out chan updateResult, service *youtube.Service, db *gorm.DB) {
 	for {
 		select {
 		case job, more := <-in:
@@ -64,10 +85,8 @@ func updateWorker(i int, in, out chan *common.Video, service *youtube.Service, d
 			}
 			if dl {
 				log.Infof("[Job %d] [Video %s] should be downloaded.", i, job.ID)
-				out <- job
-			} else {
-				out <- nil
 			}
+			out <- updateResult{video: job, dl: dl, err: err}
 		}
 	}
 }
@@ -75,16 +94,20 @@ func updateWorker(i int, in, out chan *common.Video, service *youtube.Service, d
 func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool, err error) {
 	var resp *youtube.VideoListResponse
 	if resp, err = service.Videos.List(metaUpdateParts).Id(v.ID).Do(); err != nil {
+		metrics.APIErrors.WithLabelValues(apiErrorReason(err)).Inc()
+		err = &APIError{Err: err}
 		return
 	}
 
 	var (
 		t       = time.Now()
 		fetched = v.Fetched.Valid && v.Fetched.Bool
+		changed []string
 		check   = func(fetched bool, old, new, field string) error {
 			if !fetched || old == new {
 				return nil
 			}
+			changed = append(changed, field)
 			return db.Create(&common.VideoHistory{
 				VideoID:   v.ID,
 				Field:     field,
@@ -95,11 +118,24 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 		}
 	)
 
-	var privacy = v.PrivacyStatus
+	var (
+		privacy      = v.PrivacyStatus
+		availability = v.Availability
+		broadcast    = v.BroadcastState
+		// cleared contains the columns which were reset to their zero value
+		cleared []string
+		// pending contains the events which are published after the video was saved
+		pending []events.Event
+	)
 
 	if len(resp.Items) > 0 {
 		var r = resp.Items[0]
 
+		// save full response
+		if _, err = SaveSnapshot(db, v.ID, r, t); err != nil {
+			return
+		}
+
 		// published at
 		var pa time.Time
 		if pa, err = time.Parse(time.RFC3339, r.Snippet.PublishedAt); err != nil {
@@ -115,6 +151,20 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 			}
 		}
 
+		availability = availabilityOf(r)
+		broadcast = broadcastStateOf(r)
+
+		// livestream and premiere times
+		if det := r.LiveStreamingDetails; det != nil {
+			scheduled := parseNullTime(det.ScheduledStartTime)
+			if err = check(fetched, formatNullTime(v.ScheduledStartTime), formatNullTime(scheduled), "scheduledStart"); err != nil {
+				return
+			}
+			v.ScheduledStartTime = scheduled
+			v.ActualStartTime = parseNullTime(det.ActualStartTime)
+			v.ActualEndTime = parseNullTime(det.ActualEndTime)
+		}
+
 		if r.Snippet.ChannelId != "" {
 			v.ChannelID = r.Snippet.ChannelId
 		}
@@ -123,6 +173,12 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 		if err = check(fetched, v.Title, r.Snippet.Title, "title"); err != nil {
 			return
 		}
+		if fetched && v.Title != r.Snippet.Title {
+			pending = append(pending, events.Event{Type: events.VideoTitleChanged, VideoID: v.ID, Data: events.Change{
+				Old: v.Title,
+				New: r.Snippet.Title,
+			}})
+		}
 		v.Title = r.Snippet.Title
 
 		// description
@@ -147,6 +203,16 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 				dl = true
 			}
 			v.VideoLength = det.Duration
+			if hasCaptions := det.Caption == "true"; hasCaptions != v.HasCaptions {
+				// the caption updater lists the tracks of videos whose caption state changed
+				if err = check(fetched, strconv.FormatBool(v.HasCaptions), strconv.FormatBool(hasCaptions), "captions"); err != nil {
+					return
+				}
+				if !hasCaptions {
+					cleared = append(cleared, "HasCaptions")
+				}
+				v.HasCaptions = hasCaptions
+			}
 		}
 
 		// rating
@@ -197,8 +263,11 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 			}
 		}
 	} else {
-		// if api doesn't return a video the video is most likely private
-		privacy = common.PrivatePrivacyStatus
+		// if api doesn't return a video the video is either private or deleted
+		availability = missingAvailability(v.ID, v.Availability)
+		if availability == common.PrivateAvailability {
+			privacy = common.PrivatePrivacyStatus
+		}
 	}
 
 	// video privacy state
@@ -214,11 +283,56 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 		v.PrivacyStatus = privacy
 	}
 
+	// video availability
+	if availability != v.Availability {
+		if err = check(
+			fetched,
+			strconv.Itoa(int(v.Availability)),
+			strconv.Itoa(int(availability)),
+			"availability",
+		); err != nil {
+			return
+		}
+		if availability.Unavailable() && !v.Availability.Unavailable() {
+			v.UnavailableSince = sql.NullTime{Valid: true, Time: t}
+		} else if !availability.Unavailable() && v.UnavailableSince.Valid {
+			v.UnavailableSince = sql.NullTime{}
+			cleared = append(cleared, "UnavailableSince")
+		}
+		// don't emit events for videos without a known availability
+		if fetched && v.Availability != 0 {
+			pending = append(pending, availabilityEvents(v, availability)...)
+		}
+		v.Availability = availability
+	}
+
+	// broadcast state
+	if broadcast != v.BroadcastState {
+		if err = check(
+			fetched,
+			strconv.Itoa(int(v.BroadcastState)),
+			strconv.Itoa(int(broadcast)),
+			"broadcast",
+		); err != nil {
+			return
+		}
+		// download the stream as soon as it ended
+		if v.BroadcastState.Streaming() && broadcast == common.CompletedBroadcastState {
+			dl = true
+		}
+		v.BroadcastState = broadcast
+	}
+
 	// force set dl to true if not already fetched
 	if !fetched {
 		dl = true
 	}
 
+	// defer downloads of incomplete streams until they ended
+	if broadcast.Streaming() {
+		dl = false
+	}
+
 	// mark video as fetched
 	v.Fetched = sql.NullBool{
 		Bool:  true,
@@ -228,6 +342,64 @@ func updateJob(service *youtube.Service, db *gorm.DB, v *common.Video) (dl bool,
 	// update last updated timestamp
 	v.LastUpdated = sql.NullTime{Valid: true, Time: t}
 
-	err = db.Updates(v).Error
+	if err = db.Updates(v).Error; err != nil {
+		return
+	}
+	// Updates skips zero values, so cleared columns have to be saved explicitly
+	if len(cleared) > 0 {
+		if err = db.Model(v).Select(cleared).Updates(v).Error; err != nil {
+			return
+		}
+	}
+	metrics.VideosRefreshed.Inc()
+
+	// changes are only announced once they are saved
+	for _, e := range pending {
+		events.Default.Publish(e)
+	}
+	if len(changed) > 0 {
+		events.Publish(events.VideoChanged, v.ID, events.VideoChange{Fields: changed})
+	}
+	return
+}
+
+// availabilityEvents returns the events for a changed availability of the video
+func availabilityEvents(v *common.Video, availability common.Availability) (evs []events.Event) {
+	evs = append(evs, events.Event{Type: events.VideoAvailabilityChanged, VideoID: v.ID, Data: events.Change{
+		Old: v.Availability.String(),
+		New: availability.String(),
+	}})
+	switch availability {
+	case common.PrivateAvailability:
+		evs = append(evs, events.Event{Type: events.VideoPrivate, VideoID: v.ID})
+	case common.DeletedAvailability:
+		evs = append(evs, events.Event{Type: events.VideoDeleted, VideoID: v.ID})
+	}
 	return
 }
+
+// APIError is returned if a call to the YouTube Data API failed
+type APIError struct {
+	Err error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// apiErrorReason returns the reason of the first error returned by the YouTube Data API
+// or "unknown" if the error didn't come from the API (e.g. network errors)
+func apiErrorReason(err error) string {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		if len(gerr.Errors) > 0 && gerr.Errors[0].Reason != "" {
+			return gerr.Errors[0].Reason
+		}
+		return strconv.Itoa(gerr.Code)
+	}
+	return "unknown"
+}
@@ -0,0 +1,176 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBroadcastStateOf(t *testing.T) {
+	assert.Equal(t, common.NoneBroadcastState, broadcastStateOf(&youtube.Video{
+		Snippet: &youtube.VideoSnippet{LiveBroadcastContent: "none"},
+	}))
+	assert.Equal(t, common.UpcomingBroadcastState, broadcastStateOf(&youtube.Video{
+		Snippet:              &youtube.VideoSnippet{LiveBroadcastContent: "upcoming"},
+		LiveStreamingDetails: &youtube.VideoLiveStreamingDetails{},
+	}))
+	assert.Equal(t, common.LiveBroadcastState, broadcastStateOf(&youtube.Video{
+		Snippet: &youtube.VideoSnippet{LiveBroadcastContent: "live"},
+	}))
+	assert.Equal(t, common.CompletedBroadcastState, broadcastStateOf(&youtube.Video{
+		Snippet:              &youtube.VideoSnippet{LiveBroadcastContent: "none"},
+		LiveStreamingDetails: &youtube.VideoLiveStreamingDetails{ActualEndTime: "2022-04-01T01:00:00Z"},
+	}))
+}
+
+func TestUpdateJobLivestream(t *testing.T) {
+	db := openDB(t)
+
+	video := &youtube.Video{
+		Id: "live",
+		Snippet: &youtube.VideoSnippet{
+			Title:                "Stream",
+			PublishedAt:          "2022-04-01T00:00:00Z",
+			LiveBroadcastContent: "upcoming",
+		},
+		ContentDetails: &youtube.VideoContentDetails{Duration: "P0D", ContentRating: &youtube.ContentRating{}},
+		LiveStreamingDetails: &youtube.VideoLiveStreamingDetails{
+			ScheduledStartTime: "2022-04-02T00:00:00Z",
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(youtube.VideoListResponse{Items: []*youtube.Video{video}})
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(t, err)
+
+	v := &common.Video{ID: "live"}
+	assert.NoError(t, db.Create(v).Error)
+
+	// upcoming streams are not downloaded, even if not fetched yet
+	dl, err := updateJob(service, db, v)
+	assert.NoError(t, err)
+	assert.False(t, dl)
+	assert.Equal(t, common.UpcomingBroadcastState, v.BroadcastState)
+	assert.True(t, v.ScheduledStartTime.Valid)
+
+	// neither are live streams with a changing length
+	video.Snippet.LiveBroadcastContent = "live"
+	video.ContentDetails.Duration = "PT1H"
+	video.LiveStreamingDetails.ActualStartTime = "2022-04-02T00:01:00Z"
+	dl, err = updateJob(service, db, v)
+	assert.NoError(t, err)
+	assert.False(t, dl)
+	assert.Equal(t, common.LiveBroadcastState, v.BroadcastState)
+
+	// the stream is downloaded once it ended
+	video.Snippet.LiveBroadcastContent = "none"
+	video.LiveStreamingDetails.ActualEndTime = "2022-04-02T01:00:00Z"
+	dl, err = updateJob(service, db, v)
+	assert.NoError(t, err)
+	assert.True(t, dl)
+	assert.Equal(t, common.CompletedBroadcastState, v.BroadcastState)
+
+	var stored common.Video
+	assert.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, common.CompletedBroadcastState, stored.BroadcastState)
+	assert.True(t, stored.ActualEndTime.Valid)
+}
+
+func TestUpdateVideosAPIError(t *testing.T) {
+	db := openDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 403, "errors": [{"reason": "quotaExceeded"}]}}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(t, err)
+
+	v := &common.Video{ID: "quota"}
+	assert.NoError(t, db.Create(v).Error)
+
+	_, err = UpdateVideos(service, db, []*common.Video{v})
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "quotaExceeded", apiErrorReason(err))
+
+	// the status keeps API errors apart from other errors
+	status := NewStatus()
+	status.Finish(time.Now(), err)
+	assert.Equal(t, apiErr, status.Snapshot().LastAPIErr)
+	status.Finish(time.Now(), errors.New("database is locked"))
+	assert.Error(t, status.Snapshot().LastErr)
+	assert.NoError(t, status.Snapshot().LastAPIErr)
+}
+
+func TestUpdateJobEventsAfterSave(t *testing.T) {
+	db := openDB(t)
+
+	video := &youtube.Video{
+		Id:             "saved",
+		Snippet:        &youtube.VideoSnippet{Title: "New", PublishedAt: "2022-04-01T00:00:00Z"},
+		ContentDetails: &youtube.VideoContentDetails{Duration: "PT1M", ContentRating: &youtube.ContentRating{}},
+		Status:         &youtube.VideoStatus{PrivacyStatus: "private"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(youtube.VideoListResponse{Items: []*youtube.Video{video}})
+	}))
+	defer srv.Close()
+
+	service, err := youtube.NewService(context.Background(),
+		option.WithEndpoint(srv.URL), option.WithHTTPClient(srv.Client()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Create(&common.Video{ID: "saved", Title: "Old", Fetched: sql.NullBool{Valid: true, Bool: true},
+		Availability: common.AvailableAvailability}).Error)
+	evs, cancel := events.Default.SubscribeTypes(8, events.VideoTitleChanged, events.VideoPrivate)
+	defer cancel()
+	received := func() (n int) {
+		for {
+			select {
+			case e := <-evs:
+				if e.VideoID == "saved" {
+					n++
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	// changes which couldn't be saved aren't announced
+	errSave := errors.New("cannot save")
+	assert.NoError(t, db.Callback().Update().Before("gorm:update").Register("fail", func(tx *gorm.DB) {
+		_ = tx.AddError(errSave)
+	}))
+	var v common.Video
+	assert.NoError(t, db.First(&v, "id = ?", "saved").Error)
+	_, err = updateJob(service, db, &v)
+	assert.ErrorIs(t, err, errSave)
+	assert.Equal(t, 0, received())
+
+	assert.NoError(t, db.Callback().Update().Remove("fail"))
+	assert.NoError(t, db.First(&v, "id = ?", "saved").Error)
+	_, err = updateJob(service, db, &v)
+	assert.NoError(t, err)
+	// title changed and private
+	assert.Equal(t, 2, received())
+}
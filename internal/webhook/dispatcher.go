@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/apex/log"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headers sent with every delivery
+const (
+	EventHeader     = "X-Penguin-Event"
+	DeliveryHeader  = "X-Penguin-Delivery"
+	SignatureHeader = "X-Penguin-Signature"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 30 * time.Second
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Dispatcher delivers events to all subscribed webhooks and retries failed deliveries
+type Dispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+
+	// MaxAttempts is the number of attempts until a delivery is given up
+	MaxAttempts uint
+	// Backoff is the delay before the first retry, it is doubled on every attempt
+	Backoff time.Duration
+	// RetryInterval is the interval in which due deliveries are retried
+	RetryInterval time.Duration
+}
+
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{
+		db:            db,
+		client:        &http.Client{Timeout: DefaultTimeout},
+		MaxAttempts:   DefaultMaxAttempts,
+		Backoff:       DefaultBackoff,
+		RetryInterval: 10 * time.Second,
+	}
+}
+
+// Run creates deliveries for events from the bus until ctx is done.
+// Deliveries are sent by a separate worker, so slow endpoints can't make the subscription miss events.
+// Video alerts have their own subscription, so floods of other events (e.g. progress) can't crowd them out.
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus) {
+	var other []events.Type
+	for _, t := range events.Types {
+		if !events.IsAlert(t) {
+			other = append(other, t)
+		}
+	}
+	alerts, cancelAlerts := bus.SubscribeTypes(128, events.VideoAlerts...)
+	defer cancelAlerts()
+	ch, cancel := bus.SubscribeTypes(128, other...)
+	defer cancel()
+
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.work(ctx, wake)
+	}()
+	defer func() { <-done }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-alerts:
+			d.dispatch(e, wake)
+		case e := <-ch:
+			d.dispatch(e, wake)
+		}
+	}
+}
+
+// dispatch creates the deliveries of the event and wakes up the worker
+func (d *Dispatcher) dispatch(e events.Event, wake chan<- struct{}) {
+	if err := d.Dispatch(e); err != nil {
+		log.WithError(err).Warnf("[Webhook] cannot dispatch event %s", e.Type)
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// work sends due deliveries whenever it's woken up and every RetryInterval until ctx is done
+func (d *Dispatcher) work(ctx context.Context, wake <-chan struct{}) {
+	ticker := time.NewTicker(d.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+		if err := d.RetryDue(); err != nil {
+			log.WithError(err).Warn("[Webhook] cannot send deliveries")
+		}
+	}
+}
+
+// Dispatch creates a delivery for every active webhook subscribed to the event,
+// the deliveries are sent by RetryDue
+func (d *Dispatcher) Dispatch(e events.Event) (err error) {
+	var hooks []*common.Webhook
+	if err = d.db.Where("active = ?", true).Find(&hooks).Error; err != nil {
+		return
+	}
+
+	var payload []byte
+	if payload, err = json.Marshal(e); err != nil {
+		return
+	}
+
+	for _, hook := range hooks {
+		if !Subscribed(hook, e.Type) {
+			continue
+		}
+		// a failing webhook must not keep the event from the others
+		if cerr := d.db.Create(&common.WebhookDelivery{
+			WebhookID:   hook.ID,
+			Event:       string(e.Type),
+			Payload:     string(payload),
+			NextAttempt: sql.NullTime{Valid: true, Time: time.Now()},
+		}).Error; cerr != nil {
+			log.WithError(cerr).Warnf("[Webhook] cannot create delivery of %s for webhook %d", e.Type, hook.ID)
+			err = cerr
+		}
+	}
+	return
+}
+
+// RetryDue attempts all new deliveries and all deliveries which are due for a retry
+func (d *Dispatcher) RetryDue() (err error) {
+	var due []*common.WebhookDelivery
+	if err = d.db.Preload("Webhook").
+		Where("next_attempt IS NOT NULL AND next_attempt <= ?", time.Now()).
+		Order("id").
+		Find(&due).Error; err != nil {
+		return
+	}
+	for _, delivery := range due {
+		if aerr := d.attempt(delivery); aerr != nil {
+			log.WithError(aerr).Warnf("[Webhook] cannot save delivery %d", delivery.ID)
+			err = aerr
+		}
+	}
+	return
+}
+
+// attempt sends the delivery once and saves the outcome
+func (d *Dispatcher) attempt(delivery *common.WebhookDelivery) error {
+	delivery.Attempts++
+	delivery.StatusCode, delivery.Error = 0, ""
+
+	status, err := d.send(delivery)
+	delivery.StatusCode = status
+	if err == nil {
+		delivery.Delivered = true
+		delivery.NextAttempt = sql.NullTime{}
+	} else {
+		delivery.Error = err.Error()
+		if delivery.Attempts >= d.MaxAttempts {
+			log.WithError(err).Warnf("[Webhook] giving up delivery %d to webhook %d", delivery.ID, delivery.WebhookID)
+			delivery.NextAttempt = sql.NullTime{}
+		} else {
+			backoff := d.Backoff << (delivery.Attempts - 1)
+			delivery.NextAttempt = sql.NullTime{Valid: true, Time: time.Now().Add(backoff)}
+		}
+	}
+
+	return d.db.Model(delivery).Select("Attempts", "StatusCode", "Error", "Delivered", "NextAttempt").
+		Updates(delivery).Error
+}
+
+func (d *Dispatcher) send(delivery *common.WebhookDelivery) (int, error) {
+	if delivery.Webhook == nil {
+		return 0, errors.New("webhook not found")
+	}
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(delivery.Webhook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.New("unexpected status " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribed checks if the webhook is subscribed to the event type,
+// webhooks without event types are subscribed to the video alerts and "*" subscribes to all events
+func Subscribed(hook *common.Webhook, typ events.Type) bool {
+	if hook.Events == "" {
+		return events.IsAlert(typ)
+	}
+	for _, e := range strings.Split(hook.Events, ",") {
+		if e = strings.TrimSpace(e); e == "*" || e == string(typ) {
+			return true
+		}
+	}
+	return false
+}
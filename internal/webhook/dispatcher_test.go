@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"context"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(common.TableModels...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestDispatch(t *testing.T) {
+	db := openDB(t)
+
+	var received int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "sha256="+Sign("secret", body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, string(events.VideoPrivate), r.Header.Get(EventHeader))
+		received++
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, db.Create(&common.Webhook{URL: srv.URL, Secret: "secret", Active: true}).Error)
+	assert.NoError(t, db.Create(&common.Webhook{URL: srv.URL, Secret: "secret", Active: true,
+		Events: string(events.VideoArchived)}).Error)
+
+	d := NewDispatcher(db)
+	assert.NoError(t, d.Dispatch(events.Event{ID: 1, Type: events.VideoPrivate, VideoID: "hello"}))
+	// deliveries are only created by Dispatch
+	assert.Equal(t, 0, received)
+	assert.NoError(t, d.RetryDue())
+	assert.Equal(t, 1, received)
+
+	var deliveries []*common.WebhookDelivery
+	assert.NoError(t, db.Find(&deliveries).Error)
+	if assert.Len(t, deliveries, 1) {
+		assert.True(t, deliveries[0].Delivered)
+		assert.False(t, deliveries[0].NextAttempt.Valid)
+		assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	db := openDB(t)
+
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, db.Create(&common.Webhook{URL: srv.URL, Secret: "secret", Active: true}).Error)
+
+	d := NewDispatcher(db)
+	d.Backoff = 0
+	d.MaxAttempts = 3
+
+	assert.NoError(t, d.Dispatch(events.Event{ID: 1, Type: events.VideoDeleted}))
+	assert.NoError(t, d.RetryDue())
+
+	var delivery common.WebhookDelivery
+	assert.NoError(t, db.First(&delivery).Error)
+	assert.False(t, delivery.Delivered)
+	assert.True(t, delivery.NextAttempt.Valid)
+	assert.Equal(t, uint(1), delivery.Attempts)
+	assert.Equal(t, http.StatusBadGateway, delivery.StatusCode)
+
+	// retry succeeds
+	fail = false
+	assert.NoError(t, d.RetryDue())
+	assert.NoError(t, db.First(&delivery).Error)
+	assert.True(t, delivery.Delivered)
+	assert.False(t, delivery.NextAttempt.Valid)
+	assert.Equal(t, uint(2), delivery.Attempts)
+}
+
+func TestRunSlowEndpoint(t *testing.T) {
+	db := openDB(t)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	assert.NoError(t, db.Create(&common.Webhook{URL: srv.URL, Secret: "secret", Active: true}).Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := events.NewBus(0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewDispatcher(db).Run(ctx, bus)
+	}()
+	// wait for the subscriptions
+	assert.Eventually(t, func() bool { return bus.Subscribers() == 2 }, time.Second, time.Millisecond)
+
+	// a blocked endpoint doesn't make the dispatcher miss events
+	for i := 0; i < 300; i++ {
+		bus.Publish(events.Event{Type: events.VideoDeleted})
+		time.Sleep(time.Millisecond)
+	}
+	assert.Eventually(t, func() bool {
+		var n int64
+		db.Model(&common.WebhookDelivery{}).Count(&n)
+		return n == 300
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(release)
+	cancel()
+	<-done
+}
+
+func TestRunProgressFlood(t *testing.T) {
+	db := openDB(t)
+	assert.NoError(t, db.Create(&common.Webhook{URL: "http://127.0.0.1:0", Secret: "secret", Active: true}).Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := events.NewBus(0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewDispatcher(db).Run(ctx, bus)
+	}()
+	assert.Eventually(t, func() bool { return bus.Subscribers() == 2 }, time.Second, time.Millisecond)
+
+	// progress reports can't crowd out alerts
+	for i := 0; i < 1000; i++ {
+		bus.Publish(events.Event{Type: events.QueueProgress})
+	}
+	bus.Publish(events.Event{Type: events.VideoDeleted})
+	assert.Eventually(t, func() bool {
+		var n int64
+		db.Model(&common.WebhookDelivery{}).Where("event = ?", events.VideoDeleted).Count(&n)
+		return n == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestSubscribed(t *testing.T) {
+	assert.True(t, Subscribed(&common.Webhook{}, events.VideoDeleted))
+	assert.False(t, Subscribed(&common.Webhook{}, events.QueueProgress))
+	assert.True(t, Subscribed(&common.Webhook{Events: "*"}, events.QueueProgress))
+	assert.True(t, Subscribed(&common.Webhook{Events: "*"}, events.VideoDeleted))
+	assert.True(t, Subscribed(&common.Webhook{Events: "video.private, video.deleted"}, events.VideoDeleted))
+	assert.False(t, Subscribed(&common.Webhook{Events: "video.private"}, events.VideoDeleted))
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"github.com/ICBX/penguin/internal/events"
+	"github.com/ICBX/penguin/internal/metrics"
 	"github.com/ICBX/penguin/internal/rest"
+	"github.com/ICBX/penguin/internal/search"
 	"github.com/ICBX/penguin/internal/tasks"
+	"github.com/ICBX/penguin/internal/webhook"
 	"github.com/ICBX/penguin/pkg/common"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
@@ -12,7 +16,6 @@ import (
 	"google.golang.org/api/youtube/v3"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 	"os"
 	"os/signal"
 	"sync"
@@ -25,7 +28,7 @@ func init() {
 	log.SetLevel(log.DebugLevel)
 }
 
-func startCron(ctx context.Context, wg *sync.WaitGroup, service *youtube.Service, db *gorm.DB) (err error) {
+func startCron(ctx context.Context, wg *sync.WaitGroup, service *youtube.Service, db *gorm.DB, status *tasks.Status, captionsInterval time.Duration) (err error) {
 	defer wg.Done()
 
 	c := cron.New(cron.WithSeconds())
@@ -38,20 +41,30 @@ func startCron(ctx context.Context, wg *sync.WaitGroup, service *youtube.Service
 			return
 		}
 
-		log.Infof("[Meta-Update] Updating %d videos...", len(videos))
+		videoCount := len(videos)
+		log.Infof("[Meta-Update] Updating %d videos...", videoCount)
+		events.Publish(events.UpdaterStarted, "", events.UpdaterRun{Videos: videoCount})
 
 		swStart := time.Now()
 		if videos, err = tasks.UpdateVideos(service, db, videos); err != nil {
 			log.WithError(err).Warn("cannot update videos")
 		}
 		swStop := time.Now()
+		status.Finish(swStart, err)
+		metrics.MetaUpdateDuration.Observe(swStop.Sub(swStart).Seconds())
 
 		log.Infof("[Meta-Update] Done! Took %s. %d videos should be downloaded.",
 			swStop.Sub(swStart).String(), len(videos))
 
+		events.Publish(events.UpdaterFinished, "", events.UpdaterRun{
+			Videos:    videoCount,
+			Downloads: len(videos),
+			Duration:  swStop.Sub(swStart).String(),
+		})
+
 		// add videos to download queue
 		for _, v := range videos {
-			if err = addToQueue(db, v); err != nil {
+			if err = tasks.EnqueueDownload(db, v); err != nil {
 				return
 			}
 		}
@@ -60,18 +73,72 @@ func startCron(ctx context.Context, wg *sync.WaitGroup, service *youtube.Service
 		return
 	}
 
+	if _, err = c.AddFunc("0 0 */1 * * *", func() {
+		if err := tasks.UpdateComments(ctx, service, db); err != nil {
+			log.WithError(err).Warn("[Comments] cannot archive comments")
+		}
+	}); err != nil {
+		log.WithError(err).Fatal("Cannot create comment archiver cronjob")
+		return
+	}
+
+	if _, err = c.AddFunc("0 */15 * * * *", func() {
+		if err := tasks.UpdateChannels(service, db); err != nil {
+			log.WithError(err).Warn("[Channels] cannot update channels")
+		}
+	}); err != nil {
+		log.WithError(err).Fatal("Cannot create channel updater cronjob")
+		return
+	}
+
+	if _, err = c.AddFunc("0 30 */6 * * *", func() {
+		if err := tasks.UpdateCaptions(ctx, service, db, captionsInterval); err != nil {
+			log.WithError(err).Warn("[Captions] cannot update captions")
+		}
+	}); err != nil {
+		log.WithError(err).Fatal("Cannot create caption updater cronjob")
+		return
+	}
+
+	if _, err = c.AddFunc("30 */1 * * * *", func() {
+		released, err := tasks.ReleaseStaleJobs(db, tasks.DefaultStaleProgress)
+		if err != nil {
+			log.WithError(err).Warn("[Queue] cannot release stale jobs")
+		} else if released > 0 {
+			log.Infof("[Queue] Released %d jobs without progress", released)
+		}
+	}); err != nil {
+		log.WithError(err).Fatal("Cannot create stale job cronjob")
+		return
+	}
+
+	// verify stored blobs every hour
+	if _, err = c.AddFunc("0 15 */1 * * *", func() {
+		queued, err := tasks.EnqueueScrub(db, tasks.DefaultScrubInterval, tasks.DefaultScrubBatch)
+		if err != nil {
+			log.WithError(err).Warn("[Scrub] cannot enqueue verifications")
+		} else if queued > 0 {
+			log.Infof("[Scrub] Queued verification of %d blobs", queued)
+		}
+	}); err != nil {
+		log.WithError(err).Fatal("Cannot create scrub cronjob")
+		return
+	}
+
 	go c.Run()
+	status.Start()
 	<-ctx.Done()
 
 	log.Info("[task#update] Shutting down...")
 	c.Stop()
+	status.Stop()
 
 	return
 }
 
-func startRESTApi(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB) error {
+func startRESTApi(ctx context.Context, wg *sync.WaitGroup, service *youtube.Service, db *gorm.DB, status *tasks.Status, limits rest.RateLimits) error {
 	// start REST webserver
-	r := rest.New(db)
+	r := rest.New(db, rest.WithUpdaterStatus(status), rest.WithYouTube(service), rest.WithRateLimits(limits))
 
 	go func() {
 		<-ctx.Done()
@@ -85,7 +152,18 @@ func startRESTApi(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB) error {
 	return r.Listen(":3000")
 }
 
+func startWebhooks(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB) {
+	defer wg.Done()
+
+	webhook.NewDispatcher(db).Run(ctx, events.Default)
+	log.Info("[srv#webhook] Shutting down...")
+}
+
 func main() {
+	if region := os.Getenv("REGION_CODE"); region != "" {
+		tasks.RegionCode = region
+	}
+
 	// YouTube service
 	service, err := youtube.NewService(context.Background(), option.WithAPIKey(os.Getenv("API_KEY")))
 	if err != nil {
@@ -100,32 +178,62 @@ func main() {
 		return
 	}
 	log.Info("Migrating Database...")
-	if err = db.AutoMigrate(common.TableModels...); err != nil {
+	if err = common.Migrate(db); err != nil {
 		log.WithError(err).Fatal("cannot migrate db")
 		return
 	}
+	if err = search.Migrate(db); err != nil {
+		log.WithError(err).Fatal("cannot create search index")
+		return
+	}
 	log.Info("OK!")
 
+	// PULL_INTERVAL overrides the poll interval which is requested from blobbers
+	limits := rest.DefaultRateLimits
+	if v := os.Getenv("PULL_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid PULL_INTERVAL")
+		}
+		limits.PullInterval = interval
+	}
+
+	// CAPTIONS_INTERVAL is the delay until the caption tracks of a video are listed again (0 disables relisting),
+	// every listing costs 50 quota units of the YouTube Data API
+	captionsInterval := tasks.DefaultCaptionsInterval
+	if v := os.Getenv("CAPTIONS_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid CAPTIONS_INTERVAL")
+		}
+		captionsInterval = interval
+	}
+
 	// services
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	var wg sync.WaitGroup
+	status := tasks.NewStatus()
 
 	log.Info("[SRV] Starting service cron#updater")
 	wg.Add(1)
 	go func() {
-		err := startCron(ctx, &wg, service, db)
+		err := startCron(ctx, &wg, service, db, status, captionsInterval)
 		if err != nil {
 			stop()
 			log.WithError(err).Warn("Cannot start cron service")
 		}
 	}()
 
+	log.Info("[SRV] Starting service srv#webhook")
+	wg.Add(1)
+	go startWebhooks(ctx, &wg, db)
+
 	log.Info("[SRV] Starting service api#rest")
 	wg.Add(1)
 	go func() {
-		err := startRESTApi(ctx, &wg, db)
+		err := startRESTApi(ctx, &wg, service, db, status, limits)
 		if err != nil {
 			if err != nil {
 				stop()
@@ -137,21 +245,3 @@ func main() {
 	wg.Wait()
 	log.Info("All Services Shut Down.")
 }
-
-func addToQueue(db *gorm.DB, v *common.Video) (err error) {
-	// fetch all blobbers for the video
-	if err = db.Preload("Blobbers").Where(v).First(v).Error; err != nil {
-		return
-	}
-	// add video to queue
-	for _, b := range v.Blobbers {
-		log.Infof("Adding video %s to blobber-queue %d", v.ID, b.ID)
-		if err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&common.Queue{
-			VideoID:   v.ID,
-			BlobberID: b.ID,
-		}).Error; err != nil {
-			return
-		}
-	}
-	return
-}
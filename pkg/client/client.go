@@ -0,0 +1,243 @@
+// Package client is a Go client for the REST API of the controller.
+// The routes and payloads are described in internal/rest/openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ICBX/penguin/pkg/common"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SecretHeader contains the secret of the blobber
+const SecretHeader = "Blobber-Secret"
+
+// Client sends requests to the controller, blobber routes use the configured blobber id and secret
+type Client struct {
+	baseURL string
+	http    *http.Client
+
+	blobberID uint
+	secret    string
+}
+
+// Option configures optional settings of the Client
+type Option func(c *Client)
+
+// WithHTTPClient sets the http client which is used to send requests
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithBlobber sets the credentials which are used for blobber routes
+func WithBlobber(id uint, secret string) Option {
+	return func(c *Client) {
+		c.blobberID = id
+		c.secret = secret
+	}
+}
+
+// New returns a client for the controller at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) (c *Client) {
+	c = &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return
+}
+
+// BlobberID returns the id of the configured blobber
+func (c *Client) BlobberID() uint {
+	return c.blobberID
+}
+
+//// payloads
+
+type NewVideo struct {
+	VideoID  string `json:"videoID"`
+	Blobbers []uint `json:"blobbers,omitempty"`
+	Verify   bool   `json:"verify,omitempty"`
+}
+
+type Job struct {
+	VideoID string             `json:"videoID"`
+	Action  common.QueueAction `json:"action"`
+	Type    common.BlobType    `json:"type"`
+}
+
+type PullResponse struct {
+	// Download and Remove only contain video blobs,
+	// Jobs contains all jobs including other blob types
+	Download []string `json:"download"`
+	Remove   []string `json:"remove"`
+	Jobs     []Job    `json:"jobs"`
+	// PollInterval is the ideal delay until the next pull in seconds
+	PollInterval int `json:"pollInterval,omitempty"`
+}
+
+type Report struct {
+	VideoID string             `json:"videoID"`
+	Action  common.QueueAction `json:"action"`
+	Type    common.BlobType    `json:"type"`
+	// Path is the location of the stored blob (only for GetBlob)
+	Path string `json:"path,omitempty"`
+	// Checksum is the SHA-256 hash of the stored blob (GetBlob and VerifyBlob)
+	Checksum string `json:"checksum,omitempty"`
+	// Size is the size of all files of the blob in bytes (only for GetBlob)
+	Size int64 `json:"size,omitempty"`
+	// Missing reports that the blob to verify wasn't found (only for VerifyBlob)
+	Missing bool `json:"missing,omitempty"`
+}
+
+type Progress struct {
+	VideoID string             `json:"videoID"`
+	Action  common.QueueAction `json:"action"`
+	Type    common.BlobType    `json:"type"`
+	// Stage is a free-form description like downloading or uploading
+	Stage      string `json:"stage,omitempty"`
+	BytesDone  int64  `json:"bytesDone"`
+	BytesTotal int64  `json:"bytesTotal,omitempty"`
+	// ETA is the estimated remaining time in seconds
+	ETA int64 `json:"eta,omitempty"`
+}
+
+type Heartbeat struct {
+	Version string `json:"version,omitempty"`
+	// TotalBytes and FreeBytes are the capacity of the storage of the blobber, if known
+	TotalBytes int64 `json:"totalBytes,omitempty"`
+	FreeBytes  int64 `json:"freeBytes,omitempty"`
+}
+
+type HeartbeatResponse struct {
+	Time time.Time `json:"time"`
+	// Full is set if the blobber doesn't receive downloads because of its capacity
+	Full     bool     `json:"full"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+//// errors
+
+// Error is returned for every response with a non-2xx status code
+type Error struct {
+	StatusCode int                 `json:"code"`
+	Message    string              `json:"message"`
+	Errors     []common.FieldError `json:"errors"`
+	RequestID  string              `json:"requestID"`
+	// RetryAfter is the delay requested by the controller, e.g. for 429 Too Many Requests
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("controller returned %d: %s", e.StatusCode, msg)
+}
+
+// IsStatus checks if err is an Error with the status code
+func IsStatus(err error, code int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == code
+}
+
+//// routes
+
+// AddVideo adds a video by its id or YouTube URL
+func (c *Client) AddVideo(ctx context.Context, video *NewVideo) error {
+	return c.do(ctx, http.MethodPost, "/media/video", false, video, nil)
+}
+
+// Pull returns the queue of the blobber
+func (c *Client) Pull(ctx context.Context) (res *PullResponse, err error) {
+	res = new(PullResponse)
+	if err = c.do(ctx, http.MethodGet, c.blobberPath("pull"), true, nil, res); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Report reports a finished job of the blobber
+func (c *Client) Report(ctx context.Context, report *Report) error {
+	return c.do(ctx, http.MethodPost, c.blobberPath("report"), true, report, nil)
+}
+
+// Progress reports the progress of a queued job
+func (c *Client) Progress(ctx context.Context, p *Progress) error {
+	return c.do(ctx, http.MethodPost, c.blobberPath("progress"), true, p, nil)
+}
+
+// Heartbeat reports that the blobber is alive
+func (c *Client) Heartbeat(ctx context.Context, hb *Heartbeat) (res *HeartbeatResponse, err error) {
+	res = new(HeartbeatResponse)
+	if err = c.do(ctx, http.MethodPost, c.blobberPath("heartbeat"), true, hb, res); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (c *Client) blobberPath(action string) string {
+	return "/blobber/" + url.PathEscape(strconv.FormatUint(uint64(c.blobberID), 10)) + "/" + action
+}
+
+// do sends the request with body encoded as JSON and decodes a JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, auth bool, body, out interface{}) (err error) {
+	var reader io.Reader
+	if body != nil {
+		var data []byte
+		if data, err = json.Marshal(body); err != nil {
+			return
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, method, c.baseURL+path, reader); err != nil {
+		return
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if auth {
+		req.Header.Set(SecretHeader, c.secret)
+	}
+
+	var resp *http.Response
+	if resp, err = c.http.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := &Error{StatusCode: resp.StatusCode}
+		// problem documents are JSON, other bodies are used as the message
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		if json.Unmarshal(data, e) != nil {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return e
+	}
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
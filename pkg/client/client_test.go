@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ICBX/penguin/pkg/common"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(SecretHeader) != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":401,"message":"invalid blobberID or secret","requestID":"abc"}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /blobber/7/pull":
+			_ = json.NewEncoder(w).Encode(PullResponse{
+				Download: []string{"a"},
+				Jobs:     []Job{{VideoID: "a", Action: common.GetBlob, Type: common.VideoBlobType}},
+			})
+		case "POST /blobber/7/progress":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"code":429,"message":"too many requests of blobber"}`))
+		case "POST /blobber/7/report":
+			var report Report
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+			assert.Equal(t, "/blobs/a", report.Path)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("report received"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("not found"))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(srv.URL+"/", WithBlobber(7, "secret"), WithHTTPClient(srv.Client()))
+
+	pull, err := c.Pull(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a"}, pull.Download)
+		assert.Equal(t, common.VideoBlobType, pull.Jobs[0].Type)
+	}
+	assert.NoError(t, c.Report(ctx, &Report{VideoID: "a", Action: common.GetBlob, Path: "/blobs/a"}))
+
+	// non-JSON error bodies are used as message
+	_, err = c.Heartbeat(ctx, nil)
+	assert.True(t, IsStatus(err, http.StatusNotFound))
+	assert.Contains(t, err.Error(), "not found")
+
+	// problem documents are decoded
+	_, err = New(srv.URL, WithBlobber(7, "wrong")).Pull(ctx)
+	var e *Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, http.StatusUnauthorized, e.StatusCode)
+		assert.Equal(t, "invalid blobberID or secret", e.Message)
+		assert.Equal(t, "abc", e.RequestID)
+	}
+
+	// rate limited requests carry the requested delay
+	err = c.Progress(ctx, &Progress{VideoID: "a"})
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, http.StatusTooManyRequests, e.StatusCode)
+		assert.Equal(t, 30*time.Second, e.RetryAfter)
+	}
+}
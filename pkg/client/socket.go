@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/fasthttp/websocket"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// message types of the blobber socket
+const (
+	SocketJobs     = "jobs"
+	SocketAck      = "ack"
+	SocketProgress = "progress"
+	SocketReport   = "report"
+	SocketResult   = "result"
+)
+
+const socketWriteTimeout = 10 * time.Second
+
+// SocketMessage is exchanged over the blobber socket
+type SocketMessage struct {
+	Type string `json:"type"`
+	// ID is copied to the result of a message
+	ID string `json:"id,omitempty"`
+
+	Jobs     []Job     `json:"jobs,omitempty"`
+	Progress *Progress `json:"progress,omitempty"`
+	Report   *Report   `json:"report,omitempty"`
+
+	// Error is set in results of failed messages
+	Error *Error `json:"error,omitempty"`
+}
+
+// Socket is an open connection to the controller which pushes the jobs of the blobber
+type Socket struct {
+	conn *websocket.Conn
+
+	mu     sync.Mutex
+	lastID uint64
+}
+
+// Connect opens the socket of the blobber. Jobs are pushed as SocketJobs messages
+// which are received with Read, the socket must be read continuously to answer pings.
+func (c *Client) Connect(ctx context.Context) (s *Socket, err error) {
+	u := c.baseURL + c.blobberPath("socket")
+	if strings.HasPrefix(u, "https://") {
+		u = "wss://" + strings.TrimPrefix(u, "https://")
+	} else {
+		u = "ws://" + strings.TrimPrefix(u, "http://")
+	}
+
+	header := http.Header{}
+	header.Set(SecretHeader, c.secret)
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u, header)
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			e := &Error{StatusCode: resp.StatusCode}
+			_ = json.NewDecoder(resp.Body).Decode(e)
+			return nil, e
+		}
+		return
+	}
+	return &Socket{conn: conn}, nil
+}
+
+// Read returns the next message from the controller
+func (s *Socket) Read() (msg *SocketMessage, err error) {
+	msg = new(SocketMessage)
+	if err = s.conn.ReadJSON(msg); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Send sends the message and returns its id, the result is received with Read
+func (s *Socket) Send(msg *SocketMessage) (id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.ID == "" {
+		s.lastID++
+		msg.ID = strconv.FormatUint(s.lastID, 10)
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return msg.ID, s.conn.WriteJSON(msg)
+}
+
+// Ack acknowledges received jobs
+func (s *Socket) Ack(jobs []Job) (string, error) {
+	return s.Send(&SocketMessage{Type: SocketAck, Jobs: jobs})
+}
+
+// Progress reports the progress of a download
+func (s *Socket) Progress(p *Progress) (string, error) {
+	return s.Send(&SocketMessage{Type: SocketProgress, Progress: p})
+}
+
+// Report reports a finished job
+func (s *Socket) Report(r *Report) (string, error) {
+	return s.Send(&SocketMessage{Type: SocketReport, Report: r})
+}
+
+func (s *Socket) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(socketWriteTimeout))
+	return s.conn.Close()
+}
@@ -1 +1,98 @@
 package common
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotFound is matched by all NotFoundErrors
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is matched by all ConflictErrors
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is matched by all ValidationErrors
+	ErrInvalid = errors.New("invalid")
+	// ErrBlobberFull is matched by all BlobberFullErrors
+	ErrBlobberFull = errors.New("blobber full")
+)
+
+// NotFoundError is returned if a referenced resource doesn't exist
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ID == "" {
+		return e.Resource + " not found"
+	}
+	return e.Resource + " '" + e.ID + "' not found"
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ConflictError is returned if a resource already exists or is in a conflicting state
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// BlobberFullError is returned if a download is queued for a blobber without free capacity
+type BlobberFullError struct {
+	BlobberID uint
+	Reason    string
+}
+
+func (e *BlobberFullError) Error() string {
+	return "blobber " + strconv.FormatUint(uint64(e.BlobberID), 10) + " is full: " + e.Reason
+}
+
+func (e *BlobberFullError) Is(target error) bool {
+	return target == ErrBlobberFull
+}
+
+// FieldError describes a single invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError contains all invalid fields of a request
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+// Add adds an invalid field
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Message: message})
+}
+
+// Err returns the ValidationError if any field is invalid and nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "invalid request: " + strings.Join(msgs, ", ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
@@ -0,0 +1,109 @@
+package common
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// Migrate creates and updates the tables of all TableModels.
+// Changes which AutoMigrate doesn't apply to existing tables are migrated before.
+func Migrate(db *gorm.DB) (err error) {
+	if err = migrateQueueKey(db); err != nil {
+		return fmt.Errorf("cannot migrate primary key of queue: %w", err)
+	}
+	if err = dedupBlobLocations(db); err != nil {
+		return fmt.Errorf("cannot remove duplicate blob locations: %w", err)
+	}
+	return db.AutoMigrate(TableModels...)
+}
+
+// migrateQueueKey adds the type to the primary key of queues which were created before blob types existed,
+// otherwise every video could only have a single queued download per blobber
+func migrateQueueKey(db *gorm.DB) (err error) {
+	if !db.Migrator().HasTable(&Queue{}) {
+		return
+	}
+
+	var keys int64
+	switch db.Dialector.Name() {
+	case "sqlite":
+		err = db.Raw("SELECT COUNT(*) FROM pragma_table_info('queues') WHERE name = 'type' AND pk > 0").
+			Scan(&keys).Error
+	case "postgres":
+		err = db.Raw(`SELECT COUNT(*) FROM information_schema.table_constraints c
+			JOIN information_schema.key_column_usage k ON k.constraint_name = c.constraint_name AND k.table_name = c.table_name
+			WHERE c.table_name = 'queues' AND c.constraint_type = 'PRIMARY KEY' AND k.column_name = 'type'`).
+			Scan(&keys).Error
+	default:
+		return
+	}
+	if err != nil || keys > 0 {
+		return
+	}
+
+	return db.Transaction(func(tx *gorm.DB) (err error) {
+		if db.Dialector.Name() == "postgres" {
+			// the type column is added with its default value
+			if err = tx.AutoMigrate(&Queue{}); err != nil {
+				return
+			}
+			return tx.Exec("ALTER TABLE queues DROP CONSTRAINT queues_pkey, " +
+				"ADD PRIMARY KEY (video_id, blobber_id, action, type)").Error
+		}
+		return rebuildQueue(tx)
+	})
+}
+
+// dedupBlobLocations keeps the newest location of every blob before the unique index is created,
+// blobbers which reported a download twice used to store the blob twice
+func dedupBlobLocations(db *gorm.DB) (err error) {
+	m := db.Migrator()
+	if !m.HasTable(&BlobLocation{}) || !m.HasColumn(&BlobLocation{}, "Type") ||
+		m.HasIndex(&BlobLocation{}, "idx_blob_locations_blob") {
+		return
+	}
+	return db.Exec("DELETE FROM blob_locations WHERE id NOT IN " +
+		"(SELECT MAX(id) FROM blob_locations GROUP BY video_id, blob_downloader_id, type)").Error
+}
+
+// rebuildQueue recreates the queue table because SQLite can't change the primary key of a table
+func rebuildQueue(tx *gorm.DB) (err error) {
+	m := tx.Migrator()
+	columns, err := m.ColumnTypes(&Queue{})
+	if err != nil {
+		return
+	}
+
+	// index names are unique per database, the indexes are recreated with the new table
+	var indexes []string
+	if err = tx.Raw("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'queues' AND sql IS NOT NULL").
+		Scan(&indexes).Error; err != nil {
+		return
+	}
+	for _, idx := range indexes {
+		if err = m.DropIndex(&Queue{}, idx); err != nil {
+			return
+		}
+	}
+
+	if err = m.RenameTable("queues", "queues_old"); err != nil {
+		return
+	}
+	if err = m.CreateTable(&Queue{}); err != nil {
+		return
+	}
+
+	// copy all columns which exist in both tables, missing types default to videos
+	var names []string
+	for _, c := range columns {
+		if m.HasColumn(&Queue{}, c.Name()) {
+			names = append(names, `"`+c.Name()+`"`)
+		}
+	}
+	list := strings.Join(names, ", ")
+	if err = tx.Exec("INSERT INTO queues (" + list + ") SELECT " + list + " FROM queues_old").Error; err != nil {
+		return
+	}
+	return m.DropTable("queues_old")
+}
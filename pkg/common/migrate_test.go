@@ -0,0 +1,80 @@
+package common
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+// queueV1 is the queue before blob types were added to the primary key
+type queueV1 struct {
+	VideoID    string       `gorm:"primaryKey"`
+	BlobberID  uint         `gorm:"primaryKey"`
+	Action     QueueAction  `gorm:"primaryKey"`
+	ProgressAt sql.NullTime `gorm:"index"`
+}
+
+func (queueV1) TableName() string {
+	return "queues"
+}
+
+func TestMigrateQueueKey(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, db.AutoMigrate(&queueV1{}))
+	progress := sql.NullTime{Valid: true, Time: time.Now()}
+	assert.NoError(t, db.Create(&queueV1{VideoID: "a", BlobberID: 1, Action: GetBlob, ProgressAt: progress}).Error)
+	assert.NoError(t, db.Create(&queueV1{VideoID: "a", BlobberID: 1, Action: RemoveBlob}).Error)
+
+	// AutoMigrate alone keeps the old primary key
+	assert.NoError(t, db.AutoMigrate(&Queue{}))
+	assert.Error(t, db.Create(&Queue{VideoID: "a", BlobberID: 1, Action: GetBlob, Type: CaptionBlobType}).Error)
+
+	assert.NoError(t, Migrate(db))
+	// migrating again doesn't change anything
+	assert.NoError(t, Migrate(db))
+
+	var queue []*Queue
+	assert.NoError(t, db.Order("action").Find(&queue).Error)
+	if assert.Len(t, queue, 2) {
+		assert.Equal(t, VideoBlobType, queue[0].Type)
+		assert.True(t, queue[0].ProgressAt.Valid)
+		assert.Equal(t, RemoveBlob, queue[1].Action)
+	}
+
+	// captions can be queued next to the video
+	assert.NoError(t, db.Create(&Queue{VideoID: "a", BlobberID: 1, Action: GetBlob, Type: CaptionBlobType}).Error)
+	assert.True(t, db.Migrator().HasIndex(&Queue{}, "ProgressAt"))
+	assert.False(t, db.Migrator().HasTable("queues_old"))
+}
+
+func TestDedupBlobLocations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// blob locations without the unique index
+	assert.NoError(t, db.AutoMigrate(&BlobLocation{}))
+	assert.NoError(t, db.Migrator().DropIndex(&BlobLocation{}, "idx_blob_locations_blob"))
+	for _, path := range []string{"old", "new"} {
+		assert.NoError(t, db.Create(&BlobLocation{VideoID: "a", BlobDownloaderID: 1, Path: path,
+			AddedAt: time.Now(), Type: VideoBlobType}).Error)
+	}
+	assert.NoError(t, db.Create(&BlobLocation{VideoID: "a", BlobDownloaderID: 1, Path: "caption",
+		AddedAt: time.Now(), Type: CaptionBlobType}).Error)
+
+	assert.NoError(t, Migrate(db))
+
+	var locations []*BlobLocation
+	assert.NoError(t, db.Order("id").Find(&locations).Error)
+	if assert.Len(t, locations, 2) {
+		assert.Equal(t, "new", locations[0].Path)
+		assert.Equal(t, "caption", locations[1].Path)
+	}
+	assert.True(t, db.Migrator().HasIndex(&BlobLocation{}, "idx_blob_locations_blob"))
+}
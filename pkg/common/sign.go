@@ -0,0 +1,58 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrSignatureInvalid = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// BlobPath returns the path of a blob below the public URL of a blobber
+func BlobPath(videoID string, typ BlobType) string {
+	return "/blob/" + url.PathEscape(videoID) + "/" + typ.String()
+}
+
+// SignBlobQuery returns the query parameters which authorize a GET of path until expires.
+// The signature is an HMAC-SHA256 of the path and expiry keyed with the secret of the blobber.
+func SignBlobQuery(secret, path string, expires time.Time) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return url.Values{
+		"expires":   {exp},
+		"signature": {blobSignature(secret, path, exp)},
+	}
+}
+
+// VerifyBlobQuery checks the signature of a GET of path created by SignBlobQuery
+func VerifyBlobQuery(secret, path string, query url.Values, now time.Time) error {
+	exp := query.Get("expires")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	sig, err := hex.DecodeString(query.Get("signature"))
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	want, _ := hex.DecodeString(blobSignature(secret, path, exp))
+	if !hmac.Equal(sig, want) {
+		return ErrSignatureInvalid
+	}
+	if now.Unix() > unix {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+func blobSignature(secret, path, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("GET\n" + path + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,25 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBlobSignature(t *testing.T) {
+	now := time.Now()
+	path := BlobPath("dQw4w9WgXcQ", VideoBlobType)
+	assert.Equal(t, "/blob/dQw4w9WgXcQ/video", path)
+
+	query := SignBlobQuery("secret", path, now.Add(time.Hour))
+	assert.NoError(t, VerifyBlobQuery("secret", path, query, now))
+
+	assert.ErrorIs(t, VerifyBlobQuery("wrong", path, query, now), ErrSignatureInvalid)
+	assert.ErrorIs(t, VerifyBlobQuery("secret", BlobPath("dQw4w9WgXcQ", CaptionBlobType), query, now), ErrSignatureInvalid)
+	assert.ErrorIs(t, VerifyBlobQuery("secret", path, query, now.Add(2*time.Hour)), ErrSignatureExpired)
+
+	// the expiry is part of the signature
+	query.Set("expires", "9999999999")
+	assert.ErrorIs(t, VerifyBlobQuery("secret", path, query, now), ErrSignatureInvalid)
+	assert.ErrorIs(t, VerifyBlobQuery("secret", path, nil, now), ErrSignatureInvalid)
+}
@@ -7,17 +7,33 @@ import (
 )
 
 type (
-	VideoRating   uint
-	PrivacyStatus uint
-	BlobType      uint
-	QueueAction   uint
+	VideoRating    uint
+	PrivacyStatus  uint
+	Availability   uint
+	BroadcastState uint
+	BlobType       uint
+	QueueAction    uint
 )
 
 const (
 	GetBlob QueueAction = iota + 1
 	RemoveBlob
+	// VerifyBlob asks the blobber to re-hash a stored blob
+	VerifyBlob
 )
 
+func (a QueueAction) String() string {
+	switch a {
+	case GetBlob:
+		return "get"
+	case RemoveBlob:
+		return "remove"
+	case VerifyBlob:
+		return "verify"
+	}
+	return "unknown"
+}
+
 //goland:noinspection ALL
 const (
 	NormalRating VideoRating = iota + 1
@@ -38,12 +54,95 @@ var PrivateStatusByName = map[string]PrivacyStatus{
 	"unlisted": UnlistedPrivacyStatus,
 }
 
+func (p PrivacyStatus) String() string {
+	for name, status := range PrivateStatusByName {
+		if status == p {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+//goland:noinspection ALL
+const (
+	AvailableAvailability Availability = iota + 1
+	PrivateAvailability
+	DeletedAvailability
+	RegionBlockedAvailability
+	AgeGatedAvailability
+)
+
+var AvailabilityByName = map[string]Availability{
+	"available":      AvailableAvailability,
+	"private":        PrivateAvailability,
+	"deleted":        DeletedAvailability,
+	"region-blocked": RegionBlockedAvailability,
+	"age-gated":      AgeGatedAvailability,
+}
+
+func (a Availability) String() string {
+	for name, availability := range AvailabilityByName {
+		if availability == a {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Unavailable returns true if the video cannot be watched (and downloaded) anymore.
+// Age-gated videos are still available, they only require a signed-in user.
+func (a Availability) Unavailable() bool {
+	return a == PrivateAvailability || a == DeletedAvailability || a == RegionBlockedAvailability
+}
+
+//goland:noinspection ALL
+const (
+	NoneBroadcastState BroadcastState = iota + 1
+	UpcomingBroadcastState
+	LiveBroadcastState
+	CompletedBroadcastState
+)
+
+var BroadcastStateByName = map[string]BroadcastState{
+	"none":      NoneBroadcastState,
+	"upcoming":  UpcomingBroadcastState,
+	"live":      LiveBroadcastState,
+	"completed": CompletedBroadcastState,
+}
+
+func (b BroadcastState) String() string {
+	for name, state := range BroadcastStateByName {
+		if state == b {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Streaming returns true if the broadcast has not ended yet
+func (b BroadcastState) Streaming() bool {
+	return b == UpcomingBroadcastState || b == LiveBroadcastState
+}
+
 //goland:noinspection ALL
 const (
 	VideoBlobType BlobType = iota + 1
 	ThumbnailBlobType
+	CaptionBlobType
 )
 
+func (t BlobType) String() string {
+	switch t {
+	case VideoBlobType:
+		return "video"
+	case ThumbnailBlobType:
+		return "thumbnail"
+	case CaptionBlobType:
+		return "caption"
+	}
+	return "unknown"
+}
+
 ////
 
 type APIKey struct {
@@ -67,11 +166,32 @@ type Video struct {
 	PrivacyStatus PrivacyStatus
 	DeletedAt     gorm.DeletedAt
 
+	// Availability is determined on every meta refresh,
+	// UnavailableSince is set when the video became unavailable
+	Availability     Availability
+	UnavailableSince sql.NullTime
+
+	// BroadcastState is set for livestreams and premieres,
+	// regular uploads have the NoneBroadcastState
+	BroadcastState     BroadcastState
+	ScheduledStartTime sql.NullTime
+	ActualStartTime    sql.NullTime
+	ActualEndTime      sql.NullTime
+
+	// HasCaptions is set if the video has caption tracks,
+	// CaptionsUpdated is set after the caption tracks were listed for the first time
+	HasCaptions     bool `gorm:"not null;default:false"`
+	CaptionsUpdated sql.NullTime
+
+	// ArchiveComments enables the comment archiver for the video
+	ArchiveComments bool `gorm:"not null;default:false"`
+
 	// Fetched is set after initial meta refresh
 	Fetched     sql.NullBool `gorm:"not null;default:false"`
 	LastUpdated sql.NullTime
 
-	Blobbers []*BlobDownloader `gorm:"many2many:VideosBlobDownloader"`
+	Blobbers    []*BlobDownloader `gorm:"many2many:VideosBlobDownloader"`
+	Collections []*Collection     `gorm:"many2many:CollectionVideos"`
 }
 
 type VideoHistory struct {
@@ -90,27 +210,61 @@ type Queue struct {
 	VideoID   string      `gorm:"primaryKey"`
 	BlobberID uint        `gorm:"primaryKey"`
 	Action    QueueAction `gorm:"primaryKey"`
+	Type      BlobType    `gorm:"primaryKey;default:1"`
+
+	// AckedAt is set when the blobber acknowledged a job pushed over its socket
+	AckedAt sql.NullTime
+
+	// progress reported by the blobber, ETA is the estimated remaining time in seconds at ProgressAt
+	Stage      string
+	BytesDone  int64
+	BytesTotal int64
+	ETA        int64
+	ProgressAt sql.NullTime `gorm:"index"`
 }
 
 type BlobDownloader struct {
 	ID     uint     `gorm:"primaryKey;autoIncrement"`
 	Name   string   `gorm:"not null"`
-	Secret string   `gorm:"not null"`
+	Secret string   `gorm:"not null" json:"-"`
 	Videos []*Video `gorm:"many2many:VideosBlobDownloader"`
+
+	// LastSeen is updated on every heartbeat and pull of the blobber,
+	// Version is reported by the blobber on every heartbeat
+	LastSeen sql.NullTime
+	Version  string
+
+	// TotalBytes and FreeBytes are the capacity of the storage reported on every heartbeat (0 if unknown),
+	// MaxUsageBytes limits the size of all blobs stored by the blobber (0 for no limit)
+	TotalBytes    int64
+	FreeBytes     int64
+	MaxUsageBytes int64
+
+	// PublicURL is the base URL of the endpoint which serves the stored blobs,
+	// blobs aren't served if it's empty
+	PublicURL string
 }
 
 type BlobLocation struct {
 	ID uint `gorm:"primaryKey;autoIncrement"`
 
-	VideoID string `gorm:"not null"`
+	// every blobber stores a blob once, see Migrate for older databases
+	VideoID string `gorm:"not null;uniqueIndex:idx_blob_locations_blob"`
 	Video   *Video
 
-	BlobDownloaderID uint `gorm:"not null"`
+	BlobDownloaderID uint `gorm:"not null;uniqueIndex:idx_blob_locations_blob"`
 	BlobDownloader   *BlobDownloader
 
 	Path    string    `gorm:"not null"`
 	AddedAt time.Time `gorm:"not null"`
-	Type    BlobType  `gorm:"not null"`
+	Type    BlobType  `gorm:"not null;uniqueIndex:idx_blob_locations_blob"`
+
+	// Checksum is the SHA-256 hash of the blob reported by the blobber,
+	// VerifiedAt is the time of the last successful verification
+	Checksum   string
+	VerifiedAt sql.NullTime
+	// Size is the size of all files of the blob in bytes
+	Size int64
 }
 
 type VideoViewCountHistory struct {
@@ -137,6 +291,191 @@ type VideoCommentCountHistory struct {
 	Time     time.Time `gorm:"not null"`
 }
 
+type Channel struct {
+	ID                    string
+	Title                 string
+	Description           string
+	CustomURL             string
+	SubscriberCount       uint64
+	HiddenSubscriberCount bool
+	VideoCount            uint64
+	ViewCount             uint64
+	BannerURL             string
+	AvatarURL             string
+
+	// Fetched is set after initial meta refresh
+	Fetched     sql.NullBool `gorm:"not null;default:false"`
+	LastUpdated sql.NullTime
+}
+
+type ChannelHistory struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	ChannelID string `gorm:"not null"`
+	Channel   *Channel
+
+	Field     string    `gorm:"not null"`
+	Old       string    `gorm:"not null"`
+	New       string    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+type ChannelSubscriberCountHistory struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	ChannelID   string `gorm:"not null"`
+	Channel     *Channel
+	Subscribers uint64    `gorm:"not null"`
+	Time        time.Time `gorm:"not null"`
+}
+
+type ChannelVideoCountHistory struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	ChannelID string `gorm:"not null"`
+	Channel   *Channel
+	Videos    uint64    `gorm:"not null"`
+	Time      time.Time `gorm:"not null"`
+}
+
+type ChannelViewCountHistory struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	ChannelID string `gorm:"not null"`
+	Channel   *Channel
+	Views     uint64    `gorm:"not null"`
+	Time      time.Time `gorm:"not null"`
+}
+
+type CommentThread struct {
+	ID string `gorm:"primaryKey"`
+
+	VideoID string `gorm:"not null;index"`
+	Video   *Video
+
+	TotalReplyCount uint64
+	Comments        []*Comment `gorm:"foreignKey:ThreadID"`
+}
+
+type Comment struct {
+	ID string `gorm:"primaryKey"`
+
+	ThreadID string `gorm:"not null;index"`
+	VideoID  string `gorm:"not null;index"`
+	// ParentID is empty for top-level comments
+	ParentID string
+
+	AuthorDisplayName string
+	AuthorChannelID   string
+	Text              string
+	LikeCount         uint64
+	PublishedAt       sql.NullTime
+	EditedAt          sql.NullTime
+
+	FirstSeen time.Time `gorm:"not null"`
+	LastSeen  time.Time `gorm:"not null"`
+	// DeletedSince is set if the comment was missing in an archiver run
+	DeletedSince sql.NullTime
+}
+
+type CommentHistory struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	CommentID string `gorm:"not null;index"`
+	Comment   *Comment
+
+	Old       string    `gorm:"not null"`
+	New       string    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+}
+
+type Caption struct {
+	ID string `gorm:"primaryKey"`
+
+	VideoID string `gorm:"not null;index"`
+	Video   *Video
+
+	Language    string
+	Name        string
+	TrackKind   string
+	LastUpdated sql.NullTime
+	// DeletedSince is set if the track was missing in an update
+	DeletedSince sql.NullTime
+}
+
+// SnapshotBlob contains a gzip compressed JSON snapshot of a YouTube Data API response.
+// Blobs are addressed by the SHA-256 hash of the uncompressed JSON.
+type SnapshotBlob struct {
+	Hash string `gorm:"primaryKey"`
+	Data []byte `gorm:"not null"`
+}
+
+type VideoSnapshot struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	VideoID string `gorm:"not null;index"`
+	Video   *Video
+
+	Hash string    `gorm:"not null"`
+	Time time.Time `gorm:"not null;index"`
+}
+
+// Collection groups videos, blobbers assigned to a collection are assigned to all of its videos
+type Collection struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	Name        string `gorm:"not null;uniqueIndex"`
+	Description string
+	CreatedAt   time.Time `gorm:"not null"`
+
+	Videos   []*Video          `gorm:"many2many:CollectionVideos"`
+	Blobbers []*BlobDownloader `gorm:"many2many:CollectionBlobbers"`
+}
+
+type Webhook struct {
+	ID     uint   `gorm:"primaryKey;autoIncrement"`
+	URL    string `gorm:"not null"`
+	Secret string `gorm:"not null"`
+	// Events contains a comma separated list of subscribed event types,
+	// an empty list subscribes to the video alerts and "*" to all events
+	Events    string
+	Active    bool      `gorm:"not null;default:true"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+type WebhookDelivery struct {
+	ID uint `gorm:"primaryKey;autoIncrement"`
+
+	WebhookID uint `gorm:"not null;index"`
+	Webhook   *Webhook
+
+	Event      string `gorm:"not null"`
+	Payload    string `gorm:"not null"`
+	Attempts   uint   `gorm:"not null;default:0"`
+	StatusCode int
+	Error      string
+	Delivered  bool `gorm:"not null;default:false"`
+	// NextAttempt is null if the delivery succeeded or all attempts failed
+	NextAttempt sql.NullTime `gorm:"index"`
+	CreatedAt   time.Time    `gorm:"not null"`
+	UpdatedAt   time.Time    `gorm:"not null"`
+}
+
+// AuditLog records a successful administrative request
+type AuditLog struct {
+	ID   uint      `gorm:"primaryKey;autoIncrement"`
+	Time time.Time `gorm:"not null;index"`
+	// Actor is "key:<id>" for known API keys, "token:<fingerprint>" for other bearer tokens
+	// or "anonymous", tokens are never stored
+	Actor     string `gorm:"not null;index"`
+	IP        string
+	RequestID string
+	// Action is "<resource>.<verb>", e.g. video.disable
+	Action string `gorm:"not null;index"`
+	// Target is "<resource>:<id>", e.g. video:dQw4w9WgXcQ
+	Target string `gorm:"index"`
+	// Before and After contain JSON encoded states of the target
+	Before string
+	After  string
+	Reason string
+}
+
 var TableModels = []interface{}{
 	&APIKey{},
 	&Video{},
@@ -147,4 +486,19 @@ var TableModels = []interface{}{
 	&VideoViewCountHistory{},
 	&VideoLikeCountHistory{},
 	&VideoCommentCountHistory{},
+	&Webhook{},
+	&WebhookDelivery{},
+	&SnapshotBlob{},
+	&VideoSnapshot{},
+	&CommentThread{},
+	&Comment{},
+	&CommentHistory{},
+	&Caption{},
+	&Channel{},
+	&ChannelHistory{},
+	&ChannelSubscriberCountHistory{},
+	&ChannelVideoCountHistory{},
+	&ChannelViewCountHistory{},
+	&Collection{},
+	&AuditLog{},
 }
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidVideoID = errors.New("invalid video id")
+
+// videoIDPattern matches canonical YouTube video ids
+var videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// IsValidVideoID checks if id is a canonical 11 character YouTube video id
+func IsValidVideoID(id string) bool {
+	return videoIDPattern.MatchString(id)
+}
+
+// ParseVideoID extracts the canonical video id from a video id or one of the common YouTube URL forms:
+//   - youtube.com/watch?v=<id>
+//   - youtu.be/<id>
+//   - youtube.com/shorts/<id>, /embed/<id>, /v/<id>, /e/<id>, /live/<id>
+//
+// Additional query parameters (e.g. timestamps) are ignored.
+func ParseVideoID(s string) (id string, err error) {
+	s = strings.TrimSpace(s)
+	if IsValidVideoID(s) {
+		return s, nil
+	}
+	if s == "" || !strings.Contains(s, "/") {
+		return "", ErrInvalidVideoID
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	var u *url.URL
+	if u, err = url.Parse(s); err != nil {
+		return "", ErrInvalidVideoID
+	}
+
+	var (
+		host = strings.ToLower(u.Hostname())
+		path = strings.Split(strings.Trim(u.Path, "/"), "/")
+	)
+	switch host {
+	case "youtu.be", "www.youtu.be":
+		id = path[0]
+	case "youtube.com", "www.youtube.com", "m.youtube.com", "music.youtube.com",
+		"youtube-nocookie.com", "www.youtube-nocookie.com":
+		switch path[0] {
+		case "watch":
+			id = u.Query().Get("v")
+		case "shorts", "embed", "v", "e", "live":
+			if len(path) > 1 {
+				id = path[1]
+			}
+		}
+	}
+
+	if !IsValidVideoID(id) {
+		return "", ErrInvalidVideoID
+	}
+	return id, nil
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseVideoID(t *testing.T) {
+	const id = "dQw4w9WgXcQ"
+	valid := []string{
+		id,
+		" " + id + "\n",
+		"https://www.youtube.com/watch?v=" + id,
+		"https://www.youtube.com/watch?v=" + id + "&t=42s",
+		"https://www.youtube.com/watch?feature=share&v=" + id,
+		"http://m.youtube.com/watch?v=" + id,
+		"youtube.com/watch?v=" + id,
+		"https://music.youtube.com/watch?v=" + id + "&list=RD",
+		"https://youtu.be/" + id,
+		"https://youtu.be/" + id + "?t=42",
+		"youtu.be/" + id,
+		"https://www.youtube.com/shorts/" + id,
+		"https://youtube.com/shorts/" + id + "?feature=share",
+		"https://www.youtube.com/embed/" + id + "?start=10",
+		"https://www.youtube-nocookie.com/embed/" + id,
+		"https://www.youtube.com/v/" + id,
+		"https://www.youtube.com/live/" + id + "?si=abc",
+	}
+	for _, s := range valid {
+		res, err := ParseVideoID(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, id, res, s)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"   ",
+		"hello",
+		id + "x",
+		"dQw4w9WgXc!",
+		"https://www.youtube.com/watch",
+		"https://www.youtube.com/watch?v=short",
+		"https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw",
+		"https://www.youtube.com/shorts/",
+		"https://example.com/watch?v=" + id,
+		"https://youtu.be/",
+		"://",
+	}
+	for _, s := range invalid {
+		_, err := ParseVideoID(s)
+		assert.ErrorIs(t, err, ErrInvalidVideoID, s)
+	}
+}